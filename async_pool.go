@@ -0,0 +1,111 @@
+package query
+
+import (
+	"context"
+	"sync"
+)
+
+// asyncPool is the worker pool executing the asynchronous queries.
+// The workers are started with the first query, and stopped when the bus is shut down.
+// Once stopped, the workers are not started again until the pool is reset (the shutdown of the bus is finished).
+type asyncPool struct {
+	sync.RWMutex
+	size    int
+	buffer  int
+	workers int
+	stopped bool
+	queue   chan *pendingAsyncQuery
+	closed  chan bool
+}
+
+func newAsyncPool(size int, buffer int) *asyncPool {
+	return &asyncPool{
+		size:   size,
+		buffer: buffer,
+	}
+}
+
+// configure the pool, unless it is already started.
+func (pool *asyncPool) configure(size int, buffer int) {
+	pool.Lock()
+	if pool.queue == nil {
+		pool.size = size
+		pool.buffer = buffer
+	}
+	pool.Unlock()
+}
+
+// enqueue the query, starting the workers first if necessary.
+// It blocks while the queue is full, returning the error of the context if it is done meanwhile.
+func (pool *asyncPool) enqueue(ctx context.Context, penQry *pendingAsyncQuery, work func(*pendingAsyncQuery)) error {
+	pool.start(work)
+	pool.RLock()
+	defer pool.RUnlock()
+	// the pool was stopped in the meantime
+	if pool.queue == nil {
+		return BusIsShuttingDownError
+	}
+	select {
+	case pool.queue <- penQry:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (pool *asyncPool) start(work func(*pendingAsyncQuery)) {
+	pool.RLock()
+	started := pool.queue != nil || pool.stopped
+	pool.RUnlock()
+	if started {
+		return
+	}
+	pool.Lock()
+	defer pool.Unlock()
+	if pool.queue != nil || pool.stopped {
+		return
+	}
+	size := pool.size
+	if size <= 0 {
+		size = 1
+	}
+	pool.queue = make(chan *pendingAsyncQuery, pool.buffer)
+	pool.closed = make(chan bool)
+	for i := 0; i < size; i++ {
+		go pool.worker(pool.queue, pool.closed, work)
+	}
+	pool.workers = size
+}
+
+// stop the workers once they have executed the queries enqueued, returning how many were stopped.
+// The queries enqueued afterwards are refused until the pool is reset.
+func (pool *asyncPool) stop() int {
+	pool.Lock()
+	queue, closed, workers := pool.queue, pool.closed, pool.workers
+	pool.queue, pool.closed, pool.workers = nil, nil, 0
+	pool.stopped = true
+	pool.Unlock()
+	for i := 0; i < workers; i++ {
+		queue <- nil
+		<-closed
+	}
+	return workers
+}
+
+// reset the pool once stopped, so the workers can be started again.
+func (pool *asyncPool) reset() {
+	pool.Lock()
+	pool.stopped = false
+	pool.Unlock()
+}
+
+func (pool *asyncPool) worker(queue <-chan *pendingAsyncQuery, closed chan<- bool, work func(*pendingAsyncQuery)) {
+	for penQry := range queue {
+		// nil queries are used as signals to break out
+		if penQry == nil {
+			break
+		}
+		work(penQry)
+	}
+	closed <- true
+}
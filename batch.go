@@ -0,0 +1,130 @@
+package query
+
+import (
+	"context"
+	"sync"
+)
+
+// Batch is used to execute several regular queries concurrently, with a bounded parallelism.
+// The cache adapters are consulted for all the queries first (without waiting for the handling of the others), while identical Cacheable queries (same cache key) are only handled once.
+// The Batch should be instantiated using the Batch function of the bus.
+type Batch struct {
+	bus         *Bus
+	qrys        []Query
+	parallelism int
+}
+
+// Add queries to the batch.
+func (bat *Batch) Add(qrys ...Query) *Batch {
+	bat.qrys = append(bat.qrys, qrys...)
+	return bat
+}
+
+// Parallelism limits the number of queries of the batch handled concurrently (cached results are returned regardless of it).
+// It defaults to the value provided to the BatchParallelism function of the bus.
+func (bat *Batch) Parallelism(parallelism int) *Batch {
+	bat.parallelism = parallelism
+	return bat
+}
+
+// Len returns the number of queries in the batch.
+func (bat *Batch) Len() int {
+	return len(bat.qrys)
+}
+
+// Execute the queries of the batch.
+// The results and errors are returned in the order the queries were added (the error of successful queries is nil).
+func (bat *Batch) Execute() ([]*Result, []error) {
+	return bat.ExecuteContext(context.Background())
+}
+
+// ExecuteContext executes the queries of the batch, providing them with the context.
+// The results and errors are returned in the order the queries were added (the error of successful queries is nil).
+// Identical Cacheable queries share the same result (or error), which can be identified using the IsShared function of the result.
+func (bat *Batch) ExecuteContext(ctx context.Context) ([]*Result, []error) {
+	ress := make([]*Result, len(bat.qrys))
+	errs := make([]error, len(bat.qrys))
+	parallelism := bat.parallelism
+	if parallelism <= 0 {
+		parallelism = 1
+	}
+	slots := make(chan struct{}, parallelism)
+
+	// the queries are dispatched at once, so the cache adapters are consulted for all of them first
+	wg := &sync.WaitGroup{}
+	for _, batQry := range bat.deduplicate(slots) {
+		wg.Add(1)
+		go func(batQry *batchQuery) {
+			defer wg.Done()
+			bat.execute(ctx, batQry, ress, errs)
+		}(batQry)
+	}
+	wg.Wait()
+	return ress, errs
+}
+
+//------Internal------//
+
+// batchQuery is a query of the batch, along with the positions of its identical queries.
+// The slots are shared by the queries of the batch to bound their handling.
+type batchQuery struct {
+	bus       *Bus
+	slots     chan struct{}
+	index     int
+	followers []int
+	qry       Query
+}
+
+// deduplicate the identical Cacheable queries, so that only the first of them is handled.
+func (bat *Batch) deduplicate(slots chan struct{}) []*batchQuery {
+	batQrys := make([]*batchQuery, 0, len(bat.qrys))
+	leaders := make(map[string]*batchQuery)
+	for i, qry := range bat.qrys {
+		chQry, implements := qry.(Cacheable)
+		if !implements {
+			batQrys = append(batQrys, &batchQuery{bus: bat.bus, slots: slots, index: i, qry: qry})
+			continue
+		}
+		key := string(chQry.CacheKey())
+		if leader, exists := leaders[key]; exists {
+			leader.followers = append(leader.followers, i)
+			continue
+		}
+		leaders[key] = &batchQuery{bus: bat.bus, slots: slots, index: i, qry: qry}
+		batQrys = append(batQrys, leaders[key])
+	}
+	return batQrys
+}
+
+// execute the query through the middlewares, as any other query.
+func (bat *Batch) execute(ctx context.Context, batQry *batchQuery, ress []*Result, errs []error) {
+	fn := batQry.query
+	if batQry.qry != nil {
+		fn = bat.bus.middlewares.wrap(batQry.qry, fn)
+	}
+	res, err := bat.bus.dispatch(ctx, batQry.qry, fn)
+	// the results retrieved from the cache are shared regardless, otherwise a copy is marked (so the cached instance is not)
+	if len(batQry.followers) > 0 && res != nil && !res.IsCached() {
+		res = res.sharedCopy()
+	}
+	ress[batQry.index], errs[batQry.index] = res, err
+	for _, i := range batQry.followers {
+		ress[i], errs[i] = res, err
+	}
+}
+
+// query consults the cache adapters right away, while the query waits for a slot of the batch to be handled.
+func (batQry *batchQuery) query(ctx context.Context, qry Query) (*Result, error) {
+	res, cached := batQry.bus.result(ctx, qry)
+	if cached {
+		if res.IsStale() {
+			batQry.bus.revalidate(qry)
+		}
+		return res, nil
+	}
+	batQry.slots <- struct{}{}
+	defer func() {
+		<-batQry.slots
+	}()
+	return batQry.bus.resolve(ctx, qry, res)
+}
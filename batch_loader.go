@@ -0,0 +1,140 @@
+package query
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// BatchHandler must be implemented for a type to qualify as a batch handler.
+// It is provided with the queries (of the same type) collected by a BatchLoader, and must fill the result of each query (ress[i] belongs to qrys[i]).
+// The query types must be declared (Selective), since their queries are delayed to be collected.
+type BatchHandler interface {
+	Selective
+	HandleBatch(qrys []Query, ress []*Result) error
+}
+
+// BatchLoaderOptions are used to configure a BatchLoader.
+type BatchLoaderOptions struct {
+	// Window is the duration during which the queries are collected, starting with the first query of a batch.
+	// It defaults to 1 millisecond.
+	Window time.Duration
+	// MaxBatchSize is the maximum number of queries of a batch. Full batches are handled without waiting for the window to elapse.
+	// It defaults to 0 (no limit).
+	MaxBatchSize int
+}
+
+// BatchLoader wraps a batch handler, so it can be provided to the bus as a regular handler.
+// Concurrent queries of the same type are collected into batches, which are handled by a single call of the batch handler.
+// The error returned by the batch handler is returned for every query of the batch.
+type BatchLoader struct {
+	sync.Mutex
+	hdl     BatchHandler
+	opts    BatchLoaderOptions
+	pending map[reflect.Type]*pendingBatch
+}
+
+// pendingBatch is a batch collecting queries, which the queries wait for until it is handled.
+type pendingBatch struct {
+	qrys     []Query
+	ress     []*Result
+	timer    *time.Timer
+	done     chan struct{}
+	err      error
+	panicked bool
+	value    interface{}
+}
+
+// NewBatchLoader creates a new *BatchLoader wrapping the provided batch handler.
+func NewBatchLoader(hdl BatchHandler, opts BatchLoaderOptions) *BatchLoader {
+	if opts.Window <= 0 {
+		opts.Window = time.Millisecond
+	}
+	return &BatchLoader{
+		hdl:     hdl,
+		opts:    opts,
+		pending: make(map[reflect.Type]*pendingBatch),
+	}
+}
+
+// Handle the query as part of a batch, waiting until the batch is handled.
+func (bl *BatchLoader) Handle(qry Query, res *Result) error {
+	return bl.HandleContext(context.Background(), qry, res)
+}
+
+// HandleContext handles the query as part of a batch, waiting until the batch is handled or the context is done.
+// Panics of the batch handler are propagated to every query of the batch (so they can be recovered by the bus).
+func (bl *BatchLoader) HandleContext(ctx context.Context, qry Query, res *Result) error {
+	bat := bl.collect(qry, res)
+	select {
+	case <-bat.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if bat.panicked {
+		panic(bat.value)
+	}
+	return bat.err
+}
+
+// Handles returns the query types accepted by the batch handler.
+func (bl *BatchLoader) Handles() []Query {
+	return bl.hdl.Handles()
+}
+
+// Handler returns the wrapped batch handler.
+func (bl *BatchLoader) Handler() BatchHandler {
+	return bl.hdl
+}
+
+//------Internal------//
+
+// collect adds the query to the pending batch of its type, starting a new batch if necessary.
+func (bl *BatchLoader) collect(qry Query, res *Result) *pendingBatch {
+	typ := reflect.TypeOf(qry)
+	bl.Lock()
+	defer bl.Unlock()
+	bat, pending := bl.pending[typ]
+	if !pending {
+		bat = &pendingBatch{done: make(chan struct{})}
+		bl.pending[typ] = bat
+		bat.timer = time.AfterFunc(bl.opts.Window, func() {
+			bl.flush(typ, bat)
+		})
+	}
+	bat.qrys = append(bat.qrys, qry)
+	bat.ress = append(bat.ress, res)
+	if bl.opts.MaxBatchSize > 0 && len(bat.qrys) >= bl.opts.MaxBatchSize {
+		delete(bl.pending, typ)
+		bat.timer.Stop()
+		go bl.handle(bat)
+	}
+	return bat
+}
+
+// flush handles the batch once its window elapses, unless it was already handled for being full.
+func (bl *BatchLoader) flush(typ reflect.Type, bat *pendingBatch) {
+	bl.Lock()
+	if bl.pending[typ] != bat {
+		bl.Unlock()
+		return
+	}
+	delete(bl.pending, typ)
+	bl.Unlock()
+	bl.handle(bat)
+}
+
+func (bl *BatchLoader) handle(bat *pendingBatch) {
+	completed := false
+	defer func() {
+		// the batch handler panicked
+		if !completed {
+			bat.panicked = true
+			bat.value = recover()
+		}
+		close(bat.done)
+	}()
+	bat.err = bl.hdl.HandleBatch(bat.qrys, bat.ress)
+	completed = true
+}
@@ -0,0 +1,112 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func queryBatch(bus *Bus, ids ...int) ([]*Result, []error) {
+	ress := make([]*Result, len(ids))
+	errs := make([]error, len(ids))
+	wg := &sync.WaitGroup{}
+	for i, id := range ids {
+		wg.Add(1)
+		go func(i int, id int) {
+			defer wg.Done()
+			ress[i], errs[i] = bus.Query(&testBatchQuery{id: id})
+		}(i, id)
+	}
+	wg.Wait()
+	return ress, errs
+}
+
+func TestBatchLoader(t *testing.T) {
+	bus := NewBus()
+	hdl := &testBatchHandler{}
+	bl := NewBatchLoader(hdl, BatchLoaderOptions{Window: time.Millisecond * 20})
+	bus.Handlers(&testHandler{}, bl)
+	if bl.Handler() != hdl {
+		t.Error("Unexpected batch handler.")
+	}
+
+	// the concurrent queries are handled in a single batch
+	ress, errs := queryBatch(bus, 1, 2, 3, 4, 5)
+	for i, res := range ress {
+		if errs[i] != nil {
+			t.Fatal(errs[i].Error())
+		}
+		if res.First() != fmt.Sprintf("item-%d", i+1) {
+			t.Error("Unexpected result.")
+		}
+	}
+	if batches := hdl.Batches(); len(batches) != 1 || len(batches[0]) != 5 {
+		t.Errorf("Expected a single batch (batches: %v).", batches)
+	}
+	// the other query types are not delayed
+	if res, err := bus.Query(&testQueryStruct{}); err != nil || res.First() != "bar" {
+		t.Error("Expected the query to be handled.")
+	}
+	if batches := hdl.Batches(); len(batches) != 0 {
+		t.Error("Expected the batch handler to be skipped.")
+	}
+
+	// the error of the batch is returned for every query
+	_, errs = queryBatch(bus, 1, -1)
+	for _, err := range errs {
+		if err == nil || errors.Unwrap(err).Error() != "batch failed" {
+			t.Error("Expected the batch error.")
+		}
+	}
+	hdl.Batches()
+
+	// the panics are propagated to every query
+	bus.PanicRecovery(true)
+	_, errs = queryBatch(bus, 1, 0)
+	for _, err := range errs {
+		if !errors.As(err, &ErrorHandlerPanicked{}) {
+			t.Error("Expected ErrorHandlerPanicked error.")
+		}
+	}
+	hdl.Batches()
+
+	// the queries stop waiting once their context is done
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*5)
+	defer cancel()
+	if _, err := bus.QueryContext(ctx, &testBatchQuery{id: 1}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("Expected the context error.")
+	}
+	time.Sleep(time.Millisecond * 30)
+	hdl.Batches()
+}
+
+func TestBatchLoader_MaxBatchSize(t *testing.T) {
+	bus := NewBus()
+	hdl := &testBatchHandler{}
+	bus.Handlers(NewBatchLoader(hdl, BatchLoaderOptions{Window: time.Second, MaxBatchSize: 2}))
+
+	// full batches are handled without waiting for the window to elapse
+	start := time.Now()
+	_, errs := queryBatch(bus, 1, 2, 3, 4)
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	if time.Since(start) >= time.Second {
+		t.Error("Expected the full batches to be handled immediately.")
+	}
+	batches := hdl.Batches()
+	sizes := make([]int, len(batches))
+	for i, batch := range batches {
+		sizes[i] = len(batch)
+	}
+	sort.Ints(sizes)
+	if fmt.Sprint(sizes) != "[2 2]" {
+		t.Errorf("Unexpected batches (batches: %v).", batches)
+	}
+}
@@ -0,0 +1,77 @@
+package query
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// BulkheadOptions are used to limit the concurrency of the regular queries of a given type.
+type BulkheadOptions struct {
+	// MaxConcurrent is the maximum number of queries handled concurrently. It defaults to 1.
+	MaxConcurrent int
+	// MaxQueued is the maximum number of queries waiting for their turn. Additional queries are rejected immediately.
+	// It defaults to 0 (no queueing).
+	MaxQueued int
+	// QueueTimeout limits how long queries wait for their turn before being rejected.
+	// It defaults to 0 (queries wait until their context is done).
+	QueueTimeout time.Duration
+}
+
+type bulkhead struct {
+	opts   BulkheadOptions
+	slots  chan struct{}
+	queued int32
+}
+
+func newBulkhead(opts BulkheadOptions) *bulkhead {
+	if opts.MaxConcurrent <= 0 {
+		opts.MaxConcurrent = 1
+	}
+	return &bulkhead{
+		opts:  opts,
+		slots: make(chan struct{}, opts.MaxConcurrent),
+	}
+}
+
+// acquire a slot for the query, waiting in the queue if allowed.
+// The error of the context is returned if it is done while waiting.
+func (bh *bulkhead) acquire(ctx context.Context, qry Query) error {
+	select {
+	case bh.slots <- struct{}{}:
+		return nil
+	default:
+	}
+	if int(atomic.AddInt32(&bh.queued, 1)) > bh.opts.MaxQueued {
+		atomic.AddInt32(&bh.queued, -1)
+		return NewErrorQueryRejected(qry, bh.opts.MaxConcurrent)
+	}
+	defer atomic.AddInt32(&bh.queued, -1)
+
+	var timeout <-chan time.Time
+	if bh.opts.QueueTimeout > 0 {
+		timer := time.NewTimer(bh.opts.QueueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case bh.slots <- struct{}{}:
+		return nil
+	case <-timeout:
+		return NewErrorQueryRejected(qry, bh.opts.MaxConcurrent)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (bh *bulkhead) release() {
+	<-bh.slots
+}
+
+func (bh *bulkhead) running() int {
+	return len(bh.slots)
+}
+
+func (bh *bulkhead) waiting() int {
+	return int(atomic.LoadInt32(&bh.queued))
+}
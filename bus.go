@@ -1,51 +1,102 @@
 package query
 
 import (
+	"context"
+	"fmt"
+	"log/slog"
+	"reflect"
 	"runtime"
+	"runtime/debug"
 	"sync/atomic"
 	"time"
 )
 
-const iteratorListenerTimeout = time.Second
-
 // Bus is the only struct exported and required for the query bus usage.
 // The Bus should be instantiated using the NewBus function.
 type Bus struct {
 	iteratorWorkerPoolSize int
 	iteratorQueueBuffer    int
 	iteratorResultBuffer   int
+	asyncWorkerPoolSize    int
+	asyncQueueBuffer       int
+	batchParallelism       int
+	listenerTimeout        time.Duration
+	queryTimeout           time.Duration
+	deduplication          bool
+	panicRecovery          bool
+	retryPolicy            *RetryPolicy
+	retryPolicies          map[reflect.Type]*RetryPolicy
+	bulkheads              map[reflect.Type]*bulkhead
+	rateLimiters           map[reflect.Type]*rateLimiter
 	initialized            *uint32
 	shuttingDown           *uint32
 	iteratorWorkers        *uint32
 	handlers               []Handler
 	iteratorHandlers       []IteratorHandler
+	handlerRouter          *router[Handler]
+	iteratorHandlerRouter  *router[IteratorHandler]
 	errorHandlers          []ErrorHandler
+	eventListeners         []EventListener
+	middlewares            *middlewareChain[QueryFunc]
+	iteratorMiddlewares    *middlewareChain[IteratorQueryFunc]
 	cacheAdapters          []CacheAdapter
+	metrics                MetricsCollector
+	logger                 *slog.Logger
+	logLevel               slog.Level
+	tracer                 Tracer
+	flights                *flightGroup
+	revalidations          *flightGroup
 	iteratorQueryQueue     chan *pendingIteratorQuery
+	asyncPool              *asyncPool
 	closed                 chan bool
 }
 
 // NewBus instantiates the Bus struct.
 // The Initialization of IteratorHandlers is performed separately (InitializeIteratorHandlers function) for dependency injection purposes.
 func NewBus() *Bus {
-	return &Bus{
+	bus := &Bus{
 		iteratorWorkerPoolSize: runtime.GOMAXPROCS(0),
 		iteratorQueueBuffer:    100,
 		iteratorResultBuffer:   0,
+		asyncWorkerPoolSize:    runtime.GOMAXPROCS(0),
+		asyncQueueBuffer:       100,
+		batchParallelism:       runtime.GOMAXPROCS(0),
+		listenerTimeout:        time.Second,
 		initialized:            new(uint32),
 		shuttingDown:           new(uint32),
 		iteratorWorkers:        new(uint32),
 		handlers:               make([]Handler, 0),
 		iteratorHandlers:       make([]IteratorHandler, 0),
+		handlerRouter:          newRouter[Handler](nil),
+		iteratorHandlerRouter:  newRouter[IteratorHandler](nil),
 		errorHandlers:          make([]ErrorHandler, 0),
+		eventListeners:         make([]EventListener, 0),
+		retryPolicies:          make(map[reflect.Type]*RetryPolicy),
+		bulkheads:              make(map[reflect.Type]*bulkhead),
+		rateLimiters:           make(map[reflect.Type]*rateLimiter),
 		cacheAdapters:          []CacheAdapter{NewMemoryCacheAdapter()},
+		tracer:                 noopTracer{},
+		flights:                newFlightGroup(),
+		revalidations:          newFlightGroup(),
 		closed:                 make(chan bool),
 	}
+	bus.asyncPool = newAsyncPool(bus.asyncWorkerPoolSize, bus.asyncQueueBuffer)
+	bus.middlewares = newMiddlewareChain[QueryFunc](bus.queryContext)
+	bus.iteratorMiddlewares = newMiddlewareChain[IteratorQueryFunc](bus.iteratorQueryContext)
+	return bus
 }
 
 // Handlers for the regular queries.
+// Handlers implementing Selective are only provided with the query types they declare.
+// The state changes of handlers wrapped by a CircuitBreaker are provided to the error handlers and the metrics collector.
 func (bus *Bus) Handlers(hdls ...Handler) {
+	for _, hdl := range hdls {
+		if cb, isCircuitBreaker := hdl.(*CircuitBreaker); isCircuitBreaker {
+			cb.observe(bus)
+		}
+	}
 	bus.handlers = hdls
+	bus.handlerRouter = newRouter(hdls)
 }
 
 // ErrorHandlers may optionally be provided.
@@ -54,6 +105,63 @@ func (bus *Bus) ErrorHandlers(hdls ...ErrorHandler) {
 	bus.errorHandlers = hdls
 }
 
+// EventListeners may optionally be provided.
+// They will receive the events of the querying process (queries started and completed, handlers invoked, cache decisions...).
+func (bus *Bus) EventListeners(lsts ...EventListener) {
+	bus.eventListeners = lsts
+}
+
+// Logger may optionally be provided to log the diagnostics of the querying process (queries dispatched and completed, handler chain decisions, cache decisions and shutdown progress).
+// The diagnostics are logged at the provided level, using structured attributes (query_type, query_id, cache_key, duration...).
+// Providing a nil logger disables it.
+func (bus *Bus) Logger(logger *slog.Logger, level slog.Level) {
+	bus.logger = logger
+	bus.logLevel = level
+}
+
+// MetricsCollector may optionally be provided to collect metrics of the querying process.
+// The PrometheusCollector may be used for this purpose.
+func (bus *Bus) MetricsCollector(col MetricsCollector) {
+	bus.metrics = col
+}
+
+// Tracer may optionally be provided to trace the querying process (e.g. bridging to OpenTelemetry).
+// The SpanRecorder may be used for testing purposes.
+func (bus *Bus) Tracer(tr Tracer) {
+	if tr == nil {
+		tr = noopTracer{}
+	}
+	bus.tracer = tr
+}
+
+// Use may optionally be provided with middlewares to wrap the execution of all the regular queries.
+// The middlewares are applied in the order provided, the first being the outermost.
+func (bus *Bus) Use(mws ...Middleware) {
+	bus.middlewares.use(nil, middlewareFuncs(mws)...)
+}
+
+// UseFor may optionally be provided with middlewares to wrap the execution of the regular queries of the same type as qry.
+// These middlewares are applied (in the order provided) after the ones provided to Use.
+func (bus *Bus) UseFor(qry Query, mws ...Middleware) {
+	if qry != nil {
+		bus.middlewares.use(qry, middlewareFuncs(mws)...)
+	}
+}
+
+// UseIterator may optionally be provided with middlewares to wrap the execution of all the iterator queries.
+// The middlewares are applied in the order provided, the first being the outermost.
+func (bus *Bus) UseIterator(mws ...IteratorMiddleware) {
+	bus.iteratorMiddlewares.use(nil, iteratorMiddlewareFuncs(mws)...)
+}
+
+// UseIteratorFor may optionally be provided with middlewares to wrap the execution of the iterator queries of the same type as qry.
+// These middlewares are applied (in the order provided) after the ones provided to UseIterator.
+func (bus *Bus) UseIteratorFor(qry Query, mws ...IteratorMiddleware) {
+	if qry != nil {
+		bus.iteratorMiddlewares.use(qry, iteratorMiddlewareFuncs(mws)...)
+	}
+}
+
 // CacheAdapters may optionally be provided.
 // They will be used instead of the default MemoryCacheAdapter.
 func (bus *Bus) CacheAdapters(adps ...CacheAdapter) {
@@ -89,42 +197,200 @@ func (bus *Bus) IteratorResultBuffer(buf int) {
 	bus.iteratorResultBuffer = buf
 }
 
+// AsyncWorkerPoolSize may optionally be provided to tweak the worker pool size for asynchronous queries (QueryAsync function).
+// The workers are started with the first asynchronous query, so it can only be adjusted *before* (or after the bus is shut down).
+// It defaults to the value returned by runtime.GOMAXPROCS(0).
+func (bus *Bus) AsyncWorkerPoolSize(workerPoolSize int) {
+	bus.asyncWorkerPoolSize = workerPoolSize
+	bus.asyncPool.configure(bus.asyncWorkerPoolSize, bus.asyncQueueBuffer)
+}
+
+// AsyncQueueBuffer may optionally be provided to tweak the buffer size of the asynchronous query queue.
+// Asynchronous queries block while the queue is full.
+// It can only be adjusted *before* the first asynchronous query (or after the bus is shut down).
+// It defaults to 100.
+func (bus *Bus) AsyncQueueBuffer(buf int) {
+	bus.asyncQueueBuffer = buf
+	bus.asyncPool.configure(bus.asyncWorkerPoolSize, bus.asyncQueueBuffer)
+}
+
+// BatchParallelism may optionally be provided to tweak the number of queries of a batch (QueryAll function) handled concurrently.
+// Each batch may also override it using its Parallelism function.
+// It defaults to the value returned by runtime.GOMAXPROCS(0).
+func (bus *Bus) BatchParallelism(parallelism int) {
+	bus.batchParallelism = parallelism
+}
+
+// IteratorListenerTimeout may optionally be provided to tweak how long iterator queries wait for a listener (the Iterate function of the result).
+// Once exceeded, the query is disregarded with an ErrorQueryTimedOut error.
+// Queries implementing ListenerTimeoutable override this value.
+// A timeout of 0 disables it, so the queries wait indefinitely (until closed or the context is done).
+// It defaults to 1 second.
+func (bus *Bus) IteratorListenerTimeout(timeout time.Duration) {
+	bus.listenerTimeout = timeout
+}
+
+// QueryTimeout may optionally be provided to limit the duration of the handling of regular queries.
+// Once exceeded, the query returns an ErrorQueryTimedOut error without waiting for the handlers to finish.
+// *The panics of the handlers of abandoned queries can not be recovered by the caller* (unless PanicRecovery is enabled).
+// Queries implementing Timeoutable override this value.
+// It defaults to 0 (no timeout).
+func (bus *Bus) QueryTimeout(timeout time.Duration) {
+	bus.queryTimeout = timeout
+}
+
+// InFlightDeduplication may optionally be enabled to protect the handlers from cache stampedes.
+// Concurrent Cacheable queries with the same cache key will then share a single handling, and its result (or error).
+// Shared results can be identified using the IsShared function of the result.
+// It defaults to false.
+func (bus *Bus) InFlightDeduplication(enabled bool) {
+	bus.deduplication = enabled
+}
+
+// PanicRecovery may optionally be enabled to recover from panics in handlers (and iterator handlers).
+// The panics are then converted into ErrorHandlerPanicked errors, provided to the error handlers and returned to the caller (or the consumer of the iterator result).
+// This way iterator workers survive the panics and the worker pool remains at full size.
+// It defaults to false.
+func (bus *Bus) PanicRecovery(enabled bool) {
+	bus.panicRecovery = enabled
+}
+
+// RetryPolicy may optionally be provided to retry the handlers of all the regular queries whenever they fail.
+// Each failed attempt is provided to the error handlers, while the final error reports the number of attempts (QueryError).
+// Iterator handlers are not retried.
+func (bus *Bus) RetryPolicy(policy RetryPolicy) {
+	bus.retryPolicy = &policy
+}
+
+// RetryPolicyFor may optionally be provided to retry the handlers of the regular queries of the same type as qry.
+// It overrides the policy provided to RetryPolicy.
+func (bus *Bus) RetryPolicyFor(qry Query, policy RetryPolicy) {
+	if qry != nil {
+		bus.retryPolicies[reflect.TypeOf(qry)] = &policy
+	}
+}
+
+// Bulkhead may optionally be provided to limit the number of regular queries of the same type as qry handled concurrently.
+// Queries exceeding the limit wait for their turn (as allowed by the options), otherwise they are rejected with an ErrorQueryRejected error.
+// Cached results are returned regardless of the limit. It should be provided *before* the queries are issued.
+func (bus *Bus) Bulkhead(qry Query, opts BulkheadOptions) {
+	if qry != nil {
+		bus.bulkheads[reflect.TypeOf(qry)] = newBulkhead(opts)
+	}
+}
+
+// RateLimit may optionally be provided to limit the rate of the regular queries of the same type as qry (token bucket).
+// Queries implementing RateLimitable are limited per key instead.
+// Queries exceeding the rate wait for their turn (as allowed by the options), otherwise they fail fast with an ErrorQueryRateLimited error.
+// The rate limit is verified before any handler is invoked, while cached results are returned regardless of it.
+// It should be provided *before* the queries are issued.
+func (bus *Bus) RateLimit(qry Query, opts RateLimitOptions) {
+	if qry != nil {
+		bus.rateLimiters[reflect.TypeOf(qry)] = newRateLimiter(opts)
+	}
+}
+
+// InFlight returns the number of regular queries of the same type as qry being handled and waiting for their turn.
+// Only the query types limited using Bulkhead are tracked.
+func (bus *Bus) InFlight(qry Query) (running int, queued int) {
+	if bh := bus.queryBulkhead(qry); bh != nil {
+		return bh.running(), bh.waiting()
+	}
+	return 0, 0
+}
+
 // InitializeIteratorHandlers initializes the query bus to support iterator queries.
+// Iterator handlers implementing Selective are only provided with the query types they declare.
 func (bus *Bus) InitializeIteratorHandlers(hdls ...IteratorHandler) {
 	if bus.initialize() {
 		bus.iteratorHandlers = hdls
+		bus.iteratorHandlerRouter = newRouter(hdls)
 		bus.iteratorQueryQueue = make(chan *pendingIteratorQuery, bus.iteratorQueueBuffer)
 		for i := 0; i < bus.iteratorWorkerPoolSize; i++ {
 			bus.iteratorWorkerUp()
 			go bus.iteratorWorker(bus.iteratorQueryQueue, bus.closed)
 		}
+		bus.iteratorQueueChanged()
 	}
 }
 
 // Query for a single result or a pre-populated collection.
 func (bus *Bus) Query(qry Query) (*Result, error) {
-	if err := bus.isValid(qry); err != nil {
-		return nil, err
-	}
+	return bus.QueryContext(context.Background(), qry)
+}
 
-	res, cached := bus.result(qry)
-	if cached {
-		return res, nil
+// QueryContext for a single result or a pre-populated collection.
+// The context is provided to the handlers implementing ContextHandler.
+// The propagation is stopped as soon as the context is done.
+// With a cancellable context the handlers are executed in a separate goroutine, while their panics are still raised in the goroutine of the caller.
+// *The panics of the handlers of abandoned queries (context done) can not be recovered by the caller* (unless PanicRecovery is enabled).
+func (bus *Bus) QueryContext(ctx context.Context, qry Query) (*Result, error) {
+	return bus.dispatch(ctx, qry, bus.middlewares.get(qry))
+}
+
+// QueryAsync executes the query on the async worker pool, returning a result which is pending until the query is fully handled.
+func (bus *Bus) QueryAsync(qry Query) *PendingResult {
+	return bus.QueryAsyncContext(context.Background(), qry)
+}
+
+// QueryAsyncContext executes the query on the async worker pool, returning a result which is pending until the query is fully handled.
+// The query is executed the same way as QueryContext (middlewares, cache...), using the provided context.
+// It blocks while the async queue is full, until the context is done.
+// Any error (including invalid queries) is returned by the Wait and WaitContext functions of the result.
+func (bus *Bus) QueryAsyncContext(ctx context.Context, qry Query) *PendingResult {
+	penRes := newPendingResult(qry)
+	if err := bus.isAsyncValid(qry); err != nil {
+		penRes.resolve(nil, err)
+		return penRes
+	}
+	if err := bus.asyncPool.enqueue(ctx, &pendingAsyncQuery{ctx: ctx, qry: qry, res: penRes}, bus.asyncWorker); err != nil {
+		if ctx.Err() != nil {
+			err = bus.contextError(ctx, qry)
+		} else {
+			err = NewQueryError(qry, PhaseValidation, err)
+		}
+		bus.error(qry, err)
+		penRes.resolve(nil, err)
 	}
+	return penRes
+}
+
+// QueryAll executes the queries concurrently, returning their results and errors in the same order (the error of successful queries is nil).
+// The cache adapters are consulted for all the queries first, while identical Cacheable queries (same cache key) are only handled once.
+func (bus *Bus) QueryAll(qrys ...Query) ([]*Result, []error) {
+	return bus.Batch(qrys...).Execute()
+}
 
-	return res, bus.query(qry, res)
+// QueryAllContext executes the queries concurrently, returning their results and errors in the same order (the error of successful queries is nil).
+// The context is provided to all the queries.
+func (bus *Bus) QueryAllContext(ctx context.Context, qrys ...Query) ([]*Result, []error) {
+	return bus.Batch(qrys...).ExecuteContext(ctx)
+}
+
+// Batch instantiates a batch of queries, which may be built further before being executed.
+func (bus *Bus) Batch(qrys ...Query) *Batch {
+	return &Batch{
+		bus:         bus,
+		qrys:        qrys,
+		parallelism: bus.batchParallelism,
+	}
 }
 
 // IteratorQuery uses a channel to iterate the results while they are being populated.
 // *Iterator queries are not cached*.
 func (bus *Bus) IteratorQuery(qry Query) (*IteratorResult, error) {
+	return bus.IteratorQueryContext(context.Background(), qry)
+}
+
+// IteratorQueryContext uses a channel to iterate the results while they are being populated.
+// The context is provided to the iterator handlers implementing ContextIteratorHandler.
+// The propagation is stopped as soon as the context is done.
+// *Iterator queries are not cached*.
+func (bus *Bus) IteratorQueryContext(ctx context.Context, qry Query) (*IteratorResult, error) {
 	if err := bus.isIteratorValid(qry); err != nil {
 		return nil, err
 	}
-
-	res := newIteratorResult(bus.iteratorResultBuffer)
-	bus.enqueueIteratorQuery(qry, res)
-	return res, nil
+	return bus.iteratorMiddlewares.get(qry)(ctx, qry)
 }
 
 // Shutdown the query bus gracefully.
@@ -149,6 +415,68 @@ func (bus *Bus) isShuttingDown() bool {
 	return atomic.LoadUint32(bus.shuttingDown) == 1
 }
 
+// dispatch executes the query using the provided function (the middleware chain), tracing and reporting its progress.
+func (bus *Bus) dispatch(ctx context.Context, qry Query, fn QueryFunc) (*Result, error) {
+	if err := bus.isValid(qry); err != nil {
+		return nil, err
+	}
+	var start time.Time
+	if bus.listening() || bus.logging() {
+		start = time.Now()
+		bus.emit(QueryStarted{event: event{query: qry, at: start}})
+		bus.log(ctx, "query dispatched", qry)
+	}
+	ctx, span := bus.tracer.Start(ctx, SpanInfo{Kind: SpanQuery, Query: qry, HandlerIndex: -1})
+	res, err := fn(ctx, qry)
+	if _, implements := qry.(Cacheable); implements {
+		span.SetAttribute(AttributeCacheHit, res != nil && res.IsCached())
+	}
+	span.End(err)
+	if bus.listening() || bus.logging() {
+		at := time.Now()
+		cached := res != nil && res.IsCached()
+		bus.emit(QueryCompleted{
+			event:    event{query: qry, at: at},
+			Duration: at.Sub(start),
+			Cached:   cached,
+			Err:      err,
+		})
+		bus.log(ctx, "query completed", qry, slog.Duration("duration", at.Sub(start)), slog.Bool("cached", cached), slog.Any("error", err))
+	}
+	return res, err
+}
+
+func (bus *Bus) queryContext(ctx context.Context, qry Query) (*Result, error) {
+	res, cached := bus.result(ctx, qry)
+	if cached {
+		if res.IsStale() {
+			bus.revalidate(qry)
+		}
+		return res, nil
+	}
+	return bus.resolve(ctx, qry, res)
+}
+
+// resolve handles the query which was not found in the cache.
+func (bus *Bus) resolve(ctx context.Context, qry Query, res *Result) (*Result, error) {
+	ctx, cancel := bus.withTimeout(ctx, qry)
+	defer cancel()
+	if _, implements := qry.(Cacheable); implements && bus.deduplication {
+		return bus.queryInFlight(ctx, qry, res)
+	}
+	return bus.execute(ctx, qry, res)
+}
+
+func (bus *Bus) iteratorQueryContext(ctx context.Context, qry Query) (*IteratorResult, error) {
+	res := newIteratorResult(ctx, bus.iteratorResultBuffer)
+	_, span := bus.tracer.Start(ctx, SpanInfo{Kind: SpanIteratorQueueWait, Query: qry, HandlerIndex: -1})
+	if err := bus.enqueueIteratorQuery(ctx, qry, res, span); err != nil {
+		span.End(err)
+		return nil, err
+	}
+	return res, nil
+}
+
 func (bus *Bus) iteratorWorker(qryQ <-chan *pendingIteratorQuery, closed chan<- bool) {
 	for penQry := range qryQ {
 		// nil queries are used as signals to break out
@@ -156,44 +484,257 @@ func (bus *Bus) iteratorWorker(qryQ <-chan *pendingIteratorQuery, closed chan<-
 			break
 		}
 
-		// wait for a listener
-		if penQry.res.waitListener(iteratorListenerTimeout) {
-			bus.iteratorQuery(penQry.qry, penQry.res)
-			penQry.res.close()
-			continue
+		bus.iteratorQueueChanged()
+		penQry.wait.End(nil)
+		start := time.Now()
+		// the handlers are provided with the context of the result, so they can observe it being closed
+		ctx, span := bus.tracer.Start(penQry.res.ctx, SpanInfo{Kind: SpanIteratorQuery, Query: penQry.qry, HandlerIndex: -1})
+		bus.iteratorQuery(ctx, penQry.qry, penQry.res)
+		span.End(penQry.res.Err())
+		if bus.metrics != nil {
+			bus.metrics.IteratorQueryHandled(penQry.qry, start.Sub(penQry.enqueuedAt), time.Since(start), penQry.res.Err())
 		}
-
-		bus.error(penQry.qry, NewErrorQueryTimedOut(penQry.qry))
+		if bus.logging() {
+			bus.log(ctx, "iterator query completed", penQry.qry,
+				slog.Duration("wait", start.Sub(penQry.enqueuedAt)),
+				slog.Duration("duration", time.Since(start)),
+				slog.Any("error", penQry.res.Err()),
+			)
+		}
+		penQry.res.close()
 	}
 	closed <- true
 }
 
-func (bus *Bus) iteratorQuery(qry Query, res *IteratorResult) {
-	for _, hdl := range bus.iteratorHandlers {
-		if err := hdl.Handle(qry, res); err != nil {
-			bus.error(qry, err)
+func (bus *Bus) asyncWorker(penQry *pendingAsyncQuery) {
+	res, err := bus.QueryContext(penQry.ctx, penQry.qry)
+	penQry.res.resolve(res, err)
+}
+
+func (bus *Bus) iteratorQuery(ctx context.Context, qry Query, res *IteratorResult) {
+	// wait for a listener
+	timeout := bus.iteratorListenerTimeout(qry)
+	if !res.waitListener(timeout) {
+		if res.IsClosed() {
+			return
+		}
+		if ctx.Err() != nil {
+			bus.iteratorError(qry, res, bus.contextError(ctx, qry))
+			return
+		}
+		if bus.listening() {
+			bus.emit(IteratorListenerTimedOut{event: event{query: qry, at: time.Now()}, Timeout: timeout})
+		}
+		bus.iteratorError(qry, res, NewErrorQueryListenerTimedOut(qry, timeout))
+		return
+	}
+
+	start := time.Now()
+	for _, rt := range bus.iteratorHandlerRouter.route(qry) {
+		// the consumer is gone
+		if res.IsClosed() {
+			return
+		}
+		if ctx.Err() != nil {
+			bus.iteratorError(qry, res, bus.contextError(ctx, qry))
+			return
+		}
+		if err := bus.handleIterator(ctx, rt, qry, res); err != nil {
+			bus.iteratorError(qry, res, newHandlerError(qry, PhaseIteration, rt.index, rt.hdl, 1, time.Since(start), err))
 			return
 		}
 		if res.propagationStopped() {
 			return
 		}
 	}
-	if !res.isHandled() {
-		bus.error(qry, NewErrorNoQueryHandlersFound(qry))
+	if !res.isHandled() && !res.IsClosed() {
+		bus.iteratorError(qry, res, NewErrorNoQueryHandlersFound(qry))
+	}
+}
+
+// iteratorError provides the error both to the consumer of the result and the error handlers.
+func (bus *Bus) iteratorError(qry Query, res *IteratorResult, err error) {
+	res.fail(err)
+	bus.error(qry, err)
+}
+
+func (bus *Bus) handleIterator(ctx context.Context, rt route[IteratorHandler], qry Query, res *IteratorResult) error {
+	ctx, span := bus.tracer.Start(ctx, SpanInfo{Kind: SpanHandler, Query: qry, HandlerIndex: rt.index, Handler: rt.hdl})
+	var start time.Time
+	if bus.listening() || bus.logging() {
+		start = time.Now()
 	}
+	err := bus.invokeIteratorHandler(ctx, rt.hdl, qry, res)
+	span.SetAttribute(AttributePropagationStopped, res.propagationStopped())
+	span.End(err)
+	bus.handlerInvoked(ctx, qry, rt.index, rt.hdl, start, err, res)
+	return err
 }
 
-func (bus *Bus) enqueueIteratorQuery(qry Query, res *IteratorResult) {
-	bus.iteratorQueryQueue <- &pendingIteratorQuery{
-		qry: qry,
-		res: res,
+func (bus *Bus) invokeIteratorHandler(ctx context.Context, hdl IteratorHandler, qry Query, res *IteratorResult) (err error) {
+	if bus.panicRecovery {
+		defer bus.recoverHandler(qry, &err)
 	}
+	if hdl, implements := hdl.(ContextIteratorHandler); implements {
+		return hdl.HandleContext(ctx, qry, res)
+	}
+	return hdl.Handle(qry, res)
 }
 
-func (bus *Bus) query(qry Query, res *Result) error {
-	for _, hdl := range bus.handlers {
-		if err := hdl.Handle(qry, res); err != nil {
+func (bus *Bus) enqueueIteratorQuery(ctx context.Context, qry Query, res *IteratorResult, wait Span) error {
+	select {
+	case bus.iteratorQueryQueue <- &pendingIteratorQuery{
+		qry:        qry,
+		res:        res,
+		wait:       wait,
+		enqueuedAt: time.Now(),
+	}:
+		bus.iteratorQueueChanged()
+		if bus.listening() {
+			bus.emit(IteratorEnqueued{event: event{query: qry, at: time.Now()}})
+		}
+		bus.log(ctx, "iterator query enqueued", qry)
+		return nil
+	case <-ctx.Done():
+		err := bus.contextError(ctx, qry)
+		bus.error(qry, err)
+		return err
+	}
+}
+
+// execute handles the query and provides any error thrown to the error handlers.
+// Whenever the context can be done, the handlers are executed in a separate goroutine.
+// This way the query can be abandoned as soon as the context is done, without waiting for the handlers.
+func (bus *Bus) execute(ctx context.Context, qry Query, res *Result) (*Result, error) {
+	var start time.Time
+	if bus.metrics != nil {
+		start = time.Now()
+	}
+	bh, err := bus.admit(ctx, qry)
+	if err != nil {
+		bus.queryHandled(qry, start, err)
+		bus.error(qry, err)
+		return nil, err
+	}
+
+	if ctx.Done() == nil {
+		err := bus.queryWithin(ctx, bh, qry, res)
+		bus.queryHandled(qry, start, err)
+		if err != nil {
+			bus.error(qry, err)
+		}
+		return res, err
+	}
+
+	// the handlers are executed in a separate goroutine, so the query can be abandoned as soon as the context is done
+	state := new(uint32)
+	handled := make(chan handling, 1)
+	go bus.queryDetached(ctx, bh, qry, res, state, handled)
+	var hdl handling
+	select {
+	case hdl = <-handled:
+	case <-ctx.Done():
+		if atomic.CompareAndSwapUint32(state, handlingPending, handlingSettled) {
+			// the result is abandoned, it may still be populated by the handlers
+			err = bus.contextError(ctx, qry)
+			bus.queryHandled(qry, start, err)
 			bus.error(qry, err)
+			return nil, err
+		}
+		hdl = <-handled
+	}
+	// the panics of the handlers are raised again in the goroutine of the caller
+	if hdl.panicked {
+		panic(hdl.value)
+	}
+	err = hdl.err
+	bus.queryHandled(qry, start, err)
+	if err != nil {
+		bus.error(qry, err)
+	}
+	return res, err
+}
+
+// queryHandled provides the metrics collector with the outcome of the query, as returned to the caller.
+func (bus *Bus) queryHandled(qry Query, start time.Time, err error) {
+	if bus.metrics != nil {
+		bus.metrics.QueryHandled(qry, time.Since(start), err)
+	}
+}
+
+// admit verifies the rate limit of the query and acquires its slot of the bulkhead (if any).
+func (bus *Bus) admit(ctx context.Context, qry Query) (*bulkhead, error) {
+	if rl := bus.queryRateLimiter(qry); rl != nil {
+		if err := rl.wait(ctx, qry); err != nil {
+			return nil, bus.admissionError(ctx, qry, err)
+		}
+	}
+	bh := bus.queryBulkhead(qry)
+	if bh != nil {
+		if err := bh.acquire(ctx, qry); err != nil {
+			return nil, bus.admissionError(ctx, qry, err)
+		}
+	}
+	return bh, nil
+}
+
+// admissionError converts the error of a context done while waiting for admission.
+func (bus *Bus) admissionError(ctx context.Context, qry Query, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil && err == ctxErr {
+		return bus.contextError(ctx, qry)
+	}
+	return err
+}
+
+const (
+	handlingPending uint32 = iota
+	handlingSettled
+)
+
+// handling is the outcome of the handlers executed in a separate goroutine.
+type handling struct {
+	err      error
+	panicked bool
+	value    interface{}
+}
+
+// queryDetached handles the query in a separate goroutine, providing the outcome to the caller unless it abandoned the query.
+// The panics of the handlers are recovered to be raised again by the caller, or raised again here if the query was abandoned.
+func (bus *Bus) queryDetached(ctx context.Context, bh *bulkhead, qry Query, res *Result, state *uint32, handled chan<- handling) {
+	hdl := handling{panicked: true}
+	defer func() {
+		if hdl.panicked {
+			hdl.value = recover()
+		}
+		if atomic.CompareAndSwapUint32(state, handlingPending, handlingSettled) {
+			handled <- hdl
+			return
+		}
+		if hdl.panicked {
+			panic(hdl.value)
+		}
+	}()
+	hdl.err = bus.queryWithin(ctx, bh, qry, res)
+	hdl.panicked = false
+}
+
+// queryWithin handles the query, releasing its slot of the bulkhead (if any) once the handlers finish.
+// Even abandoned queries hold their slot until then.
+func (bus *Bus) queryWithin(ctx context.Context, bh *bulkhead, qry Query, res *Result) error {
+	if bh != nil {
+		defer bh.release()
+	}
+	return bus.query(ctx, qry, res)
+}
+
+func (bus *Bus) query(ctx context.Context, qry Query, res *Result) error {
+	start := time.Now()
+
+	for _, rt := range bus.handlerRouter.route(qry) {
+		if ctx.Err() != nil {
+			return bus.contextError(ctx, qry)
+		}
+		if err := bus.handleWithRetries(ctx, rt, qry, res, start); err != nil {
 			return err
 		}
 		if res.propagationStopped() {
@@ -202,38 +743,242 @@ func (bus *Bus) query(qry Query, res *Result) error {
 	}
 
 	if !res.isHandled() {
-		err := NewErrorNoQueryHandlersFound(qry)
-		bus.error(qry, err)
+		return NewErrorNoQueryHandlersFound(qry)
+	}
+
+	bus.handleCache(ctx, qry, res)
+	return nil
+}
+
+// queryInFlight shares the handling of the query with the concurrent identical queries.
+// Whenever the context of the leading query is done, one of the followers takes over the handling.
+func (bus *Bus) queryInFlight(ctx context.Context, qry Query, res *Result) (*Result, error) {
+	key := string(res.CacheKey())
+	for {
+		flt, leader := bus.flights.join(key)
+		if leader {
+			landed := false
+			defer func() {
+				// the handlers panicked
+				if !landed {
+					bus.flights.abandon(key, flt)
+				}
+			}()
+			res, err := bus.execute(ctx, qry, res)
+			landed = true
+			// the errors of the leader's context are not shared with the followers
+			if err != nil && ctx.Err() != nil {
+				bus.flights.abandon(key, flt)
+			} else {
+				res = bus.flights.land(key, flt, res, err)
+			}
+			return res, err
+		}
+
+		select {
+		case <-flt.done:
+			if !flt.abandoned {
+				return flt.res, flt.err
+			}
+		case <-ctx.Done():
+			err := bus.contextError(ctx, qry)
+			bus.error(qry, err)
+			return nil, err
+		}
+	}
+}
+
+// revalidate refreshes the cached result of the query in the background.
+// Concurrent revalidations of the same query are discarded.
+func (bus *Bus) revalidate(qry Query) {
+	res := newCacheableResult(qry.(Cacheable))
+	key := string(res.CacheKey())
+	flt, leader := bus.revalidations.lead(key)
+	if !leader {
+		return
+	}
+	if bus.logging() {
+		bus.log(context.Background(), "query result revalidating", qry, slog.String("cache_key", key))
+	}
+	go func() {
+		// the query timeout prevents a hanging refresh from blocking the following ones
+		ctx, cancel := bus.withTimeout(context.Background(), qry)
+		defer cancel()
+		res, err := bus.execute(ctx, qry, res)
+		bus.revalidations.land(key, flt, res, err)
+	}()
+}
+
+func (bus *Bus) iteratorListenerTimeout(qry Query) time.Duration {
+	if qry, implements := qry.(ListenerTimeoutable); implements {
+		return qry.ListenerTimeout()
+	}
+	return bus.listenerTimeout
+}
+
+func (bus *Bus) withTimeout(ctx context.Context, qry Query) (context.Context, context.CancelFunc) {
+	timeout := bus.queryTimeout
+	if qry, implements := qry.(Timeoutable); implements {
+		timeout = qry.Timeout()
+	}
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeoutCause(ctx, timeout, NewErrorQueryHandlingTimedOut(qry, timeout))
+}
+
+// contextError determines the error of a query whose context is done.
+func (bus *Bus) contextError(ctx context.Context, qry Query) error {
+	if err, timedOut := context.Cause(ctx).(ErrorQueryTimedOut); timedOut {
 		return err
 	}
+	return NewErrorQueryContextDone(qry, ctx.Err())
+}
+
+// handleWithRetries invokes the handler, retrying it according to the retry policy of the query.
+// The changes of failed attempts to the result (data, Handled and Done) are discarded before retrying.
+func (bus *Bus) handleWithRetries(ctx context.Context, rt route[Handler], qry Query, res *Result, start time.Time) error {
+	policy := bus.queryRetryPolicy(qry)
+	snap := res.snapshot()
+	for attempt := 1; ; attempt++ {
+		hdlErr := bus.handle(ctx, rt, qry, res)
+		if hdlErr == nil {
+			return nil
+		}
+		err := newHandlerError(qry, PhaseHandling, rt.index, rt.hdl, attempt, time.Since(start), hdlErr)
+		if policy == nil || !policy.retryable(attempt, hdlErr) {
+			return err
+		}
+		bus.error(qry, err)
+		if !policy.wait(ctx, attempt) {
+			return bus.contextError(ctx, qry)
+		}
+		res.restore(snap)
+	}
+}
 
-	bus.handleCache(qry, res)
+func (bus *Bus) queryRateLimiter(qry Query) *rateLimiter {
+	if len(bus.rateLimiters) > 0 {
+		return bus.rateLimiters[reflect.TypeOf(qry)]
+	}
+	return nil
+}
+
+func (bus *Bus) queryBulkhead(qry Query) *bulkhead {
+	if len(bus.bulkheads) > 0 {
+		return bus.bulkheads[reflect.TypeOf(qry)]
+	}
 	return nil
 }
 
-func (bus *Bus) result(qry Query) (*Result, bool) {
-	if qry, implements := qry.(Cacheable); implements {
+func (bus *Bus) queryRetryPolicy(qry Query) *RetryPolicy {
+	if len(bus.retryPolicies) > 0 {
+		if policy, found := bus.retryPolicies[reflect.TypeOf(qry)]; found {
+			return policy
+		}
+	}
+	return bus.retryPolicy
+}
+
+func (bus *Bus) handle(ctx context.Context, rt route[Handler], qry Query, res *Result) error {
+	ctx, span := bus.tracer.Start(ctx, SpanInfo{Kind: SpanHandler, Query: qry, HandlerIndex: rt.index, Handler: rt.hdl})
+	var start time.Time
+	if bus.listening() || bus.logging() {
+		start = time.Now()
+	}
+	err := bus.invokeHandler(ctx, rt.hdl, qry, res)
+	span.SetAttribute(AttributePropagationStopped, res.propagationStopped())
+	span.End(err)
+	bus.handlerInvoked(ctx, qry, rt.index, rt.hdl, start, err, res)
+	return err
+}
+
+func (bus *Bus) invokeHandler(ctx context.Context, hdl Handler, qry Query, res *Result) (err error) {
+	if bus.panicRecovery {
+		defer bus.recoverHandler(qry, &err)
+	}
+	if hdl, implements := hdl.(ContextHandler); implements {
+		return hdl.HandleContext(ctx, qry, res)
+	}
+	return hdl.Handle(qry, res)
+}
+
+// recoverHandler converts the panic of a handler (if any) into an ErrorHandlerPanicked error.
+// It must be deferred directly by the function invoking the handler.
+func (bus *Bus) recoverHandler(qry Query, err *error) {
+	if val := recover(); val != nil {
+		*err = NewErrorHandlerPanicked(qry, val, string(debug.Stack()))
+	}
+}
+
+func (bus *Bus) result(ctx context.Context, qry Query) (*Result, bool) {
+	if chQry, implements := qry.(Cacheable); implements {
+		now := time.Now()
 		for _, adp := range bus.cacheAdapters {
-			if res := adp.Get(qry); res != nil {
-				res.loadedFromCache()
-				return res, true
+			res := bus.cacheGet(ctx, adp, qry, chQry, now)
+			if res == nil {
+				continue
+			}
+			if res.isExpired(now) {
+				res.markStale()
 			}
+			res.loadedFromCache()
+			bus.cacheLookup(qry, res, true)
+			return res, true
 		}
-		return newCacheableResult(qry), false
+		res := newCacheableResult(chQry)
+		bus.cacheLookup(qry, res, false)
+		return res, false
 	}
 	return newResult(), false
 }
 
-func (bus *Bus) handleCache(qry Query, res *Result) {
-	if qry, implements := qry.(Cacheable); implements && qry.CacheDuration() > 0 {
+// cacheGet retrieves the cached result of the query from the adapter.
+// Expired results are disregarded once their stale window is over.
+func (bus *Bus) cacheGet(ctx context.Context, adp CacheAdapter, qry Query, chQry Cacheable, now time.Time) *Result {
+	_, span := bus.tracer.Start(ctx, SpanInfo{Kind: SpanCacheGet, Query: qry, HandlerIndex: -1, CacheAdapter: adp})
+	res := adp.Get(chQry)
+	if res != nil && res.isExpired(now) && now.After(res.StaleUntil()) {
+		res = nil
+	}
+	span.SetAttribute(AttributeCacheHit, res != nil)
+	span.End(nil)
+	return res
+}
+
+func (bus *Bus) handleCache(ctx context.Context, qry Query, res *Result) {
+	if chQry, implements := qry.(Cacheable); implements && chQry.CacheDuration() > 0 {
 		at := time.Now()
-		res.expires(at.Add(qry.CacheDuration()))
+		res.expires(at.Add(chQry.CacheDuration()))
+		if rvQry, implements := qry.(Revalidatable); implements && rvQry.StaleDuration() > 0 {
+			res.stalesUntil(res.ExpiresAt().Add(rvQry.StaleDuration()))
+		}
 		cached := false
 		for _, adp := range bus.cacheAdapters {
-			cached = cached || adp.Set(qry, res)
+			// the result is stored in the first adapter accepting it
+			if cached {
+				break
+			}
+			_, span := bus.tracer.Start(ctx, SpanInfo{Kind: SpanCacheSet, Query: qry, HandlerIndex: -1, CacheAdapter: adp})
+			cached = adp.Set(chQry, res)
+			span.SetAttribute(AttributeCacheStored, cached)
+			span.End(nil)
 		}
 		if cached {
 			res.cached(at)
+			if bus.listening() {
+				bus.emit(CacheStored{event: event{query: qry, at: at}, CacheKey: res.CacheKey(), ExpiresAt: res.ExpiresAt()})
+			}
+		}
+		if bus.logging() {
+			bus.log(ctx, "query cache store", qry,
+				slog.String("cache_key", string(res.CacheKey())),
+				slog.Bool("stored", cached),
+				slog.Time("expires_at", res.ExpiresAt()),
+			)
+		}
+		if bus.metrics != nil {
+			bus.metrics.CacheStored(qry, cached)
 		}
 	}
 }
@@ -246,23 +991,115 @@ func (bus *Bus) iteratorWorkerDown() {
 	atomic.AddUint32(bus.iteratorWorkers, ^uint32(0))
 }
 
+func (bus *Bus) iteratorQueueChanged() {
+	if bus.metrics != nil {
+		bus.metrics.IteratorQueue(int(atomic.LoadUint32(bus.iteratorWorkers)), len(bus.iteratorQueryQueue))
+	}
+}
+
+func (bus *Bus) cacheLookup(qry Query, res *Result, hit bool) {
+	if bus.metrics != nil {
+		bus.metrics.CacheLookup(qry, hit)
+	}
+	if bus.listening() {
+		evt := event{query: qry, at: time.Now()}
+		if hit {
+			bus.emit(CacheHit{event: evt, CacheKey: res.CacheKey(), Stale: res.IsStale()})
+		} else {
+			bus.emit(CacheMiss{event: evt, CacheKey: res.CacheKey()})
+		}
+	}
+	if bus.logging() {
+		bus.log(context.Background(), "query cache lookup", qry,
+			slog.String("cache_key", string(res.CacheKey())),
+			slog.Bool("hit", hit),
+			slog.Bool("stale", hit && res.IsStale()),
+		)
+	}
+}
+
+// handlerInvoked provides a handler invocation to the event listeners and the logger.
+func (bus *Bus) handlerInvoked(ctx context.Context, qry Query, index int, hdl interface{}, start time.Time, err error, res handlingState) {
+	if !bus.listening() && !bus.logging() {
+		return
+	}
+	at := time.Now()
+	bus.log(ctx, "query handler invoked", qry,
+		slog.Int("handler_index", index),
+		slog.String("handler_type", fmt.Sprintf("%T", hdl)),
+		slog.String("decision", handlerDecision(res)),
+		slog.Duration("duration", at.Sub(start)),
+		slog.Any("error", err),
+	)
+	if !bus.listening() {
+		return
+	}
+	bus.emit(HandlerInvoked{
+		event:        event{query: qry, at: at},
+		HandlerIndex: index,
+		Handler:      hdl,
+		Duration:     at.Sub(start),
+		Err:          err,
+	})
+	if res.propagationStopped() {
+		bus.emit(PropagationStopped{event: event{query: qry, at: at}, HandlerIndex: index, Handler: hdl})
+	}
+}
+
+func (bus *Bus) circuitStateChanged(qry Query, cb *CircuitBreaker, from CircuitState, to CircuitState) {
+	if col, implements := bus.metrics.(CircuitBreakerCollector); implements {
+		col.CircuitStateChanged(cb.Handler(), from, to)
+	}
+	if bus.logging() {
+		bus.log(context.Background(), "query circuit state changed", qry,
+			slog.String("handler_type", fmt.Sprintf("%T", cb.Handler())),
+			slog.String("from", from.String()),
+			slog.String("to", to.String()),
+		)
+	}
+	bus.error(qry, NewErrorCircuitStateChanged(qry, cb.Handler(), from, to))
+}
+
 func (bus *Bus) shutdown() {
+	ctx := context.Background()
+	start := time.Now()
+	bus.log(ctx, "query bus shutting down", nil, slog.Int("iterator_workers", int(atomic.LoadUint32(bus.iteratorWorkers))))
 	for atomic.LoadUint32(bus.iteratorWorkers) > 0 {
 		bus.iteratorQueryQueue <- nil
 		<-bus.closed
 		bus.iteratorWorkerDown()
+		bus.iteratorQueueChanged()
+		bus.log(ctx, "query bus iterator worker stopped", nil, slog.Int("iterator_workers", int(atomic.LoadUint32(bus.iteratorWorkers))))
+	}
+	if workers := bus.asyncPool.stop(); workers > 0 {
+		bus.log(ctx, "query bus async workers stopped", nil, slog.Int("async_workers", workers))
 	}
 	for _, adp := range bus.cacheAdapters {
 		adp.Shutdown()
 	}
+	bus.asyncPool.reset()
 	atomic.CompareAndSwapUint32(bus.initialized, 1, 0)
 	atomic.CompareAndSwapUint32(bus.shuttingDown, 1, 0)
+	bus.log(ctx, "query bus shut down", nil, slog.Duration("duration", time.Since(start)))
 }
 
 func (bus *Bus) isValid(qry Query) error {
 	var err error
 	if qry == nil {
-		err = InvalidQueryError
+		err = NewQueryError(qry, PhaseValidation, InvalidQueryError)
+		bus.error(qry, err)
+		return err
+	}
+	return nil
+}
+
+func (bus *Bus) isAsyncValid(qry Query) error {
+	err := bus.isValid(qry)
+	if err != nil {
+		return err
+	}
+	if bus.isShuttingDown() {
+		err = NewQueryError(qry, PhaseValidation, BusIsShuttingDownError)
 		bus.error(qry, err)
 		return err
 	}
@@ -275,18 +1112,43 @@ func (bus *Bus) isIteratorValid(qry Query) error {
 		return err
 	}
 	if !bus.isInitialized() {
-		err = BusNotInitializedError
+		err = NewQueryError(qry, PhaseValidation, BusNotInitializedError)
 		bus.error(qry, err)
 		return err
 	}
 	if bus.isShuttingDown() {
-		err = BusIsShuttingDownError
+		err = NewQueryError(qry, PhaseValidation, BusIsShuttingDownError)
 		bus.error(qry, err)
 		return err
 	}
 	return nil
 }
 
+func (bus *Bus) listening() bool {
+	return len(bus.eventListeners) > 0
+}
+
+func (bus *Bus) logging() bool {
+	return bus.logger != nil
+}
+
+// log provides the diagnostics to the logger, describing the query (if any) using structured attributes.
+func (bus *Bus) log(ctx context.Context, msg string, qry Query, attrs ...slog.Attr) {
+	if bus.logger == nil || !bus.logger.Enabled(ctx, bus.logLevel) {
+		return
+	}
+	if qry != nil {
+		attrs = append(queryAttrs(qry), attrs...)
+	}
+	bus.logger.LogAttrs(ctx, bus.logLevel, msg, attrs...)
+}
+
+func (bus *Bus) emit(evt Event) {
+	for _, lst := range bus.eventListeners {
+		lst.Handle(evt)
+	}
+}
+
 func (bus *Bus) error(qry Query, err error) {
 	for _, errHdl := range bus.errorHandlers {
 		errHdl.Handle(qry, err)
@@ -1,8 +1,14 @@
 package query
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -60,9 +66,9 @@ func TestBus_Query(t *testing.T) {
 	bus.Handlers(hdl, hdlWErr, hdlCache)
 
 	_, err := bus.Query(nil)
-	if err == nil || err != InvalidQueryError {
+	if !errors.Is(err, InvalidQueryError) {
 		t.Error("Expected InvalidQueryError error.")
-	} else if err.Error() != "query: invalid query" {
+	} else if errors.Unwrap(err).Error() != "query: invalid query" {
 		t.Error("Unexpected InvalidQueryError message.")
 	}
 
@@ -193,15 +199,15 @@ func TestBus_IteratorQuery(t *testing.T) {
 	itrHdlWErr := &testIteratorHandlerWithErrors{}
 
 	_, err := bus.IteratorQuery(nil)
-	if err == nil || err != InvalidQueryError {
+	if !errors.Is(err, InvalidQueryError) {
 		t.Error("Expected InvalidQueryError error.")
-	} else if err.Error() != "query: invalid query" {
+	} else if errors.Unwrap(err).Error() != "query: invalid query" {
 		t.Error("Unexpected InvalidQueryError message.")
 	}
 	_, err = bus.IteratorQuery(&testQueryStruct{})
-	if err == nil || err != BusNotInitializedError {
+	if !errors.Is(err, BusNotInitializedError) {
 		t.Error("Expected BusNotInitializedError error.")
-	} else if err.Error() != "query: the bus is not initialized" {
+	} else if errors.Unwrap(err).Error() != "query: the bus is not initialized" {
 		t.Error("Unexpected BusNotInitializedError message.")
 	}
 
@@ -277,6 +283,242 @@ func TestBus_IteratorQuery(t *testing.T) {
 	}
 }
 
+func TestBus_QueryContext(t *testing.T) {
+	bus := NewBus()
+	bus.Handlers(&testContextHandler{}, &testHandler{})
+
+	ctx := context.WithValue(context.Background(), testContextKey{}, "bar")
+	res, err := bus.QueryContext(ctx, &testQueryStruct{})
+	if err != nil {
+		t.Error(err.Error())
+	}
+	if res.First() != "bar" {
+		t.Error("Query returned an unexpected value.")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = bus.QueryContext(ctx, &testQueryStruct{}); !errors.Is(err, context.Canceled) {
+		t.Error("Expected context.Canceled error.")
+	}
+
+	// the first handler cancels the context, the second must not be reached
+	ctx, cancel = context.WithCancel(context.Background())
+	ctx = context.WithValue(ctx, testContextKey{}, cancel)
+	_, err = bus.QueryContext(ctx, &testQueryError{})
+	ok := false
+	if err, ok = err.(ErrorQueryContextDone); ok && err.Error() != fmt.Sprintf("query: the context of the query %T is done: %s", &testQueryError{}, context.Canceled) {
+		t.Error("Unexpected ErrorQueryContextDone message.")
+	}
+	if !ok {
+		t.Error("Expected ErrorQueryContextDone error.")
+	}
+}
+
+func TestBus_IteratorQueryContext(t *testing.T) {
+	bus := NewBus()
+	errHdl := &storeErrorsHandler{
+		errs: make(map[string]error),
+	}
+	bus.ErrorHandlers(errHdl)
+	bus.InitializeIteratorHandlers(&testContextIteratorHandler{}, &testIteratorHandlerWithErrors{})
+
+	ctx := context.WithValue(context.Background(), testContextKey{}, "bar")
+	res, err := bus.IteratorQueryContext(ctx, &testQueryStruct{})
+	if err != nil {
+		t.Error(err.Error())
+	}
+	if val := <-res.Iterate(); val != "bar" {
+		t.Error("Query returned an unexpected value.")
+	}
+
+	// the first handler cancels the context, the second must not be reached
+	qryErr := &testQueryError{}
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx = context.WithValue(ctx, testContextKey{}, cancel)
+	res, err = bus.IteratorQueryContext(ctx, qryErr)
+	if err != nil {
+		t.Error(err.Error())
+	}
+	for range res.Iterate() {
+	}
+	if err = errHdl.Error(qryErr); !errors.Is(err, context.Canceled) {
+		t.Error("Expected context.Canceled error.")
+	}
+
+	// the context is canceled while waiting for a listener
+	qry := &testQueryStruct{}
+	ctx, cancel = context.WithCancel(context.Background())
+	_, err = bus.IteratorQueryContext(ctx, qry)
+	if err != nil {
+		t.Error(err.Error())
+	}
+	cancel()
+	time.Sleep(time.Millisecond * 10)
+	if err = errHdl.Error(qry); !errors.Is(err, context.Canceled) {
+		t.Error("Expected context.Canceled error.")
+	}
+}
+
+func TestBus_IteratorResultErr(t *testing.T) {
+	bus := NewBus()
+	bus.InitializeIteratorHandlers(&testIteratorHandler{}, &testIteratorHandlerWithErrors{})
+
+	res, err := bus.IteratorQuery(&testQueryStruct{})
+	if err != nil {
+		t.Error(err.Error())
+	}
+	for range res.Iterate() {
+	}
+	if res.Err() != nil {
+		t.Error("The iteration was not expected to fail.")
+	}
+
+	res, err = bus.IteratorQuery(&testQueryError{})
+	if err != nil {
+		t.Error(err.Error())
+	}
+	for range res.Iterate() {
+	}
+	var qryErr QueryError
+	if !errors.As(res.Err(), &qryErr) || qryErr.Unwrap().Error() != "query failed" || qryErr.Phase() != PhaseIteration {
+		t.Error("Expected the handler error.")
+	}
+
+	res, err = bus.IteratorQuery(&testQueryUnsupported{})
+	if err != nil {
+		t.Error(err.Error())
+	}
+	for range res.Iterate() {
+	}
+	if _, ok := res.Err().(ErrorNoQueryHandlersFound); !ok {
+		t.Error("Expected ErrorNoQueryHandlersFound error.")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	res, err = bus.IteratorQueryContext(ctx, &testQueryStruct{})
+	if err != nil {
+		t.Error(err.Error())
+	}
+	cancel()
+	time.Sleep(time.Millisecond * 10)
+	for range res.Iterate() {
+	}
+	if !errors.Is(res.Err(), context.Canceled) {
+		t.Error("Expected context.Canceled error.")
+	}
+
+	// iterating after the listener timed out
+	bus.IteratorListenerTimeout(time.Millisecond * 50)
+	res, err = bus.IteratorQuery(&testQueryStruct{})
+	if err != nil {
+		t.Error(err.Error())
+	}
+	time.Sleep(time.Millisecond * 100)
+	for range res.Iterate() {
+		t.Error("Query was not expected to yield values.")
+	}
+	if _, ok := res.Err().(ErrorQueryTimedOut); !ok {
+		t.Error("Expected ErrorQueryTimedOut error.")
+	}
+}
+
+func TestBus_IteratorListenerTimeout(t *testing.T) {
+	bus := NewBus()
+	errHdl := &storeErrorsHandler{
+		errs: make(map[string]error),
+	}
+	bus.ErrorHandlers(errHdl)
+	bus.IteratorListenerTimeout(time.Millisecond * 50)
+	bus.InitializeIteratorHandlers(&testIteratorHandler{})
+
+	qry := &testQueryStruct{}
+	res, err := bus.IteratorQuery(qry)
+	if err != nil {
+		t.Error(err.Error())
+	}
+	time.Sleep(time.Millisecond * 100)
+	for range res.Iterate() {
+	}
+	if err, ok := res.Err().(ErrorQueryTimedOut); !ok || err.Timeout() != time.Millisecond*50 {
+		t.Error("Expected ErrorQueryTimedOut error.")
+	}
+	if err, ok := errHdl.Error(qry).(ErrorQueryTimedOut); !ok || err.Timeout() != time.Millisecond*50 {
+		t.Error("Expected ErrorQueryTimedOut error.")
+	}
+
+	// the timeout is overridden by the query
+	res, err = bus.IteratorQuery(&testListenerTimeoutQuery{timeout: time.Millisecond * 300})
+	if err != nil {
+		t.Error(err.Error())
+	}
+	time.Sleep(time.Millisecond * 100)
+	if val := <-res.Iterate(); val != "bar" {
+		t.Error("Query returned an unexpected value.")
+	}
+
+	// the timeout is disabled
+	bus.IteratorListenerTimeout(0)
+	res, err = bus.IteratorQuery(&testQueryStruct{})
+	if err != nil {
+		t.Error(err.Error())
+	}
+	time.Sleep(time.Millisecond * 100)
+	if val := <-res.Iterate(); val != "bar" {
+		t.Error("Query returned an unexpected value.")
+	}
+}
+
+func TestBus_IteratorResultClose(t *testing.T) {
+	bus := NewBus()
+	hdl := &testInfiniteIteratorHandler{stopped: make(chan bool, 1)}
+	bus.IteratorWorkerPoolSize(1)
+	bus.InitializeIteratorHandlers(hdl, &testIteratorHandler{})
+
+	res, err := bus.IteratorQuery(&testQueryUnsupported{})
+	if err != nil {
+		t.Error(err.Error())
+	}
+	for val := range res.Iterate() {
+		if val == 3 {
+			res.Close()
+			break
+		}
+	}
+	select {
+	case closed := <-hdl.stopped:
+		if !closed {
+			t.Error("The handler was expected to observe the closed result.")
+		}
+	case <-time.After(time.Second):
+		t.Error("The handler was expected to stop yielding.")
+	}
+
+	// the single worker must be available again
+	res, err = bus.IteratorQuery(&testQueryStruct{})
+	if err != nil {
+		t.Error(err.Error())
+	}
+	if val := <-res.Iterate(); val != "bar" {
+		t.Error("Query returned an unexpected value.")
+	}
+
+	// closing before iterating frees the worker without waiting for a listener
+	res, err = bus.IteratorQuery(&testQueryStruct{})
+	if err != nil {
+		t.Error(err.Error())
+	}
+	res.Close()
+	start := time.Now()
+	res, err = bus.IteratorQuery(&testQueryStruct{})
+	if err != nil {
+		t.Error(err.Error())
+	}
+	if val := <-res.Iterate(); val != "bar" || time.Since(start) >= time.Second {
+		t.Error("The worker was expected to be freed.")
+	}
+}
+
 func TestBus_Shutdown(t *testing.T) {
 	bus := NewBus()
 	hdl := &testHandler{}
@@ -308,9 +550,9 @@ func TestBus_Shutdown(t *testing.T) {
 		t.Error("The bus should be shutting down.")
 	}
 	_, err = bus.IteratorQuery(&testQueryStruct{})
-	if err == nil || err != BusIsShuttingDownError {
+	if !errors.Is(err, BusIsShuttingDownError) {
 		t.Error("Expected BusIsShuttingDownError error.")
-	} else if err.Error() != "query: the bus is shutting down" {
+	} else if errors.Unwrap(err).Error() != "query: the bus is shutting down" {
 		t.Error("Unexpected BusIsShuttingDownError message.")
 	}
 	wg.Wait()
@@ -335,6 +577,1083 @@ func TestBus_HandlerOrder(t *testing.T) {
 	}
 }
 
+func TestBus_QueryTimeout(t *testing.T) {
+	bus := NewBus()
+	errHdl := &storeErrorsHandler{
+		errs: make(map[string]error),
+	}
+	bus.ErrorHandlers(errHdl)
+	bus.Handlers(&testSlowHandler{}, &testHandler{})
+	bus.QueryTimeout(time.Millisecond * 50)
+
+	qry := &testSlowQuery{}
+	start := time.Now()
+	res, err := bus.Query(qry)
+	if time.Since(start) >= time.Millisecond*200 {
+		t.Error("The query was not expected to wait for the handler.")
+	}
+	if res != nil {
+		t.Error("The result was expected to be abandoned.")
+	}
+	ok := false
+	if err, ok = err.(ErrorQueryTimedOut); ok && err.Error() != fmt.Sprintf("query: the handling of the query %T timed out after %s", qry, time.Millisecond*50) {
+		t.Error("Unexpected ErrorQueryTimedOut message.")
+	}
+	if !ok {
+		t.Error("Expected ErrorQueryTimedOut error.")
+	}
+	if err, ok := errHdl.Error(qry).(ErrorQueryTimedOut); !ok || err.Timeout() != time.Millisecond*50 {
+		t.Error("Expected ErrorQueryTimedOut error.")
+	}
+
+	// fast queries are not affected
+	res, err = bus.Query(&testQueryStruct{})
+	if err != nil {
+		t.Error(err.Error())
+	}
+	if res.First() != "bar" {
+		t.Error("Query returned an unexpected value.")
+	}
+
+	// the timeout is overridden by the query
+	res, err = bus.Query(&testTimeoutQuery{testSlowQuery{timeout: 0}})
+	if err != nil {
+		t.Error(err.Error())
+	}
+	if res.First() != "bar" {
+		t.Error("Query returned an unexpected value.")
+	}
+	_, err = bus.Query(&testTimeoutQuery{testSlowQuery{timeout: time.Millisecond * 10}})
+	if err, ok := err.(ErrorQueryTimedOut); !ok || err.Timeout() != time.Millisecond*10 {
+		t.Error("Expected ErrorQueryTimedOut error.")
+	}
+
+	// the context deadline is distinguished from the timeout
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	_, err = bus.QueryContext(ctx, qry)
+	if _, ok := err.(ErrorQueryContextDone); !ok || !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("Expected ErrorQueryContextDone error.")
+	}
+}
+
+func TestBus_Middlewares(t *testing.T) {
+	bus := NewBus()
+	bus.Handlers(&testHandler{}, &testCacheHandler{})
+	mutex := &sync.Mutex{}
+	calls := make([]string, 0)
+	record := func(name string) Middleware {
+		return func(next QueryFunc) QueryFunc {
+			return func(ctx context.Context, qry Query) (*Result, error) {
+				mutex.Lock()
+				calls = append(calls, name)
+				mutex.Unlock()
+				return next(ctx, qry)
+			}
+		}
+	}
+	bus.Use(record("global-1"), record("global-2"))
+	bus.UseFor(&testQueryStruct{}, record("typed-1"))
+	bus.Use(record("global-3"))
+	bus.UseFor(&testQueryStruct{}, record("typed-2"))
+
+	res, err := bus.Query(&testQueryStruct{})
+	if err != nil {
+		t.Error(err.Error())
+	}
+	if res.First() != "bar" {
+		t.Error("Query returned an unexpected value.")
+	}
+	if fmt.Sprint(calls) != "[global-1 global-2 global-3 typed-1 typed-2]" {
+		t.Error("The middleware order MUST be respected.")
+	}
+
+	calls = calls[:0]
+	if _, err = bus.Query(testQueryString("test")); err != nil {
+		t.Error(err.Error())
+	}
+	if fmt.Sprint(calls) != "[global-1 global-2 global-3]" {
+		t.Error("Only the global middlewares were expected.")
+	}
+
+	// the middlewares can observe the cache status and short-circuit the execution
+	cached := make([]bool, 0)
+	bus.UseFor(&testCacheQuery{}, func(next QueryFunc) QueryFunc {
+		return func(ctx context.Context, qry Query) (*Result, error) {
+			res, err := next(ctx, qry)
+			if err == nil {
+				cached = append(cached, res.IsCached())
+			}
+			return res, err
+		}
+	})
+	bus.UseFor(&testQueryUnsupported{}, func(next QueryFunc) QueryFunc {
+		return func(ctx context.Context, qry Query) (*Result, error) {
+			return NewResult("short-circuit"), nil
+		}
+	})
+	bus.UseFor(&testQueryError{}, func(next QueryFunc) QueryFunc {
+		return func(ctx context.Context, qry Query) (*Result, error) {
+			return nil, errors.New("unauthorized")
+		}
+	})
+	for i := 0; i < 2; i++ {
+		if _, err = bus.Query(&testCacheQuery{}); err != nil {
+			t.Error(err.Error())
+		}
+	}
+	if fmt.Sprint(cached) != "[false true]" {
+		t.Error("The middleware was expected to observe the cache status.")
+	}
+	res, err = bus.Query(&testQueryUnsupported{})
+	if err != nil {
+		t.Error(err.Error())
+	}
+	if res.First() != "short-circuit" {
+		t.Error("Query returned an unexpected value.")
+	}
+	if _, err = bus.Query(&testQueryError{}); err == nil || err.Error() != "unauthorized" {
+		t.Error("Expected the middleware error.")
+	}
+}
+
+func TestBus_IteratorMiddlewares(t *testing.T) {
+	bus := NewBus()
+	bus.InitializeIteratorHandlers(&testIteratorHandler{})
+	calls := make([]string, 0)
+	record := func(name string) IteratorMiddleware {
+		return func(next IteratorQueryFunc) IteratorQueryFunc {
+			return func(ctx context.Context, qry Query) (*IteratorResult, error) {
+				calls = append(calls, name)
+				return next(ctx, qry)
+			}
+		}
+	}
+	bus.UseIteratorFor(&testQueryStruct{}, record("typed"))
+	bus.UseIterator(record("global"))
+	bus.UseIteratorFor(&testQueryUnsupported{}, func(next IteratorQueryFunc) IteratorQueryFunc {
+		return func(ctx context.Context, qry Query) (*IteratorResult, error) {
+			return nil, errors.New("unauthorized")
+		}
+	})
+
+	res, err := bus.IteratorQuery(&testQueryStruct{})
+	if err != nil {
+		t.Error(err.Error())
+	}
+	if val := <-res.Iterate(); val != "bar" {
+		t.Error("Query returned an unexpected value.")
+	}
+	if fmt.Sprint(calls) != "[global typed]" {
+		t.Error("The middleware order MUST be respected.")
+	}
+	if _, err = bus.IteratorQuery(&testQueryUnsupported{}); err == nil || err.Error() != "unauthorized" {
+		t.Error("Expected the middleware error.")
+	}
+}
+
+func TestBus_InFlightDeduplication(t *testing.T) {
+	bus := NewBus()
+	hdl := &testCountingHandler{handled: new(uint32), delay: time.Millisecond * 100}
+	bus.Handlers(hdl)
+	bus.InFlightDeduplication(true)
+
+	wg := &sync.WaitGroup{}
+	results := make([]*Result, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			res, err := bus.Query(&testCountingCacheQuery{key: "STAMPEDE"})
+			if err != nil {
+				t.Error(err.Error())
+			}
+			results[i] = res
+		}(i)
+	}
+	wg.Wait()
+	if hdl.Handled() != 1 {
+		t.Error("Concurrent identical queries were expected to be handled once.")
+	}
+	for _, res := range results {
+		if res != results[0] || !res.IsShared() {
+			t.Error("Result was expected to be shared.")
+		}
+		if res.First() != "bar" {
+			t.Error("Query returned an unexpected value.")
+		}
+	}
+	// the cached result is not marked as shared
+	res, err := bus.Query(&testCountingCacheQuery{key: "STAMPEDE"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !res.IsCached() || res.IsShared() {
+		t.Error("Cached result was not expected to be shared.")
+	}
+
+	// the followers take over whenever the context of the leader is done
+	ctx, cancel := context.WithCancel(context.Background())
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := bus.QueryContext(ctx, &testCountingCacheQuery{key: "CANCELED-LEADER"})
+		leaderErr <- err
+	}()
+	time.Sleep(time.Millisecond * 10)
+	go func() {
+		time.Sleep(time.Millisecond * 10)
+		cancel()
+	}()
+	res, err = bus.Query(&testCountingCacheQuery{key: "CANCELED-LEADER"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if res.First() != "bar" {
+		t.Error("Query returned an unexpected value.")
+	}
+	if _, ok := (<-leaderErr).(ErrorQueryContextDone); !ok {
+		t.Error("Expected ErrorQueryContextDone error.")
+	}
+	if hdl.Handled() != 3 {
+		t.Error("Expected the follower to handle the query again.")
+	}
+
+	// a different cache key must not be deduplicated
+	res, err = bus.Query(&testCountingCacheQuery{key: "OTHER"})
+	if err != nil {
+		t.Error(err.Error())
+	}
+	if res.IsShared() || hdl.Handled() != 4 {
+		t.Error("Result was not expected to be shared.")
+	}
+
+	// without deduplication every query is handled
+	bus = NewBus()
+	hdl = &testCountingHandler{handled: new(uint32), delay: time.Millisecond * 100}
+	bus.Handlers(hdl)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = bus.Query(&testCountingCacheQuery{key: "STAMPEDE"})
+		}()
+	}
+	wg.Wait()
+	if hdl.Handled() != 10 {
+		t.Error("Concurrent identical queries were expected to be handled individually.")
+	}
+}
+
+func TestBus_StaleWhileRevalidate(t *testing.T) {
+	bus := NewBus()
+	hdl := &testCountingHandler{handled: new(uint32), delay: time.Millisecond * 20}
+	bus.Handlers(hdl)
+	qry := &testStaleCacheQuery{testCountingCacheQuery{key: "STALE"}}
+
+	res, err := bus.Query(qry)
+	if err != nil {
+		t.Error(err.Error())
+	}
+	if res.IsStale() || !res.StaleUntil().Equal(res.ExpiresAt().Add(qry.StaleDuration())) {
+		t.Error("Result was not expected to be stale.")
+	}
+
+	// the expired result is returned immediately and refreshed in the background
+	time.Sleep(time.Millisecond * 100)
+	for i := 0; i < 10; i++ {
+		res, err = bus.Query(qry)
+		if err != nil {
+			t.Error(err.Error())
+		}
+		if !res.IsStale() || !res.IsCached() || res.First() != "bar" {
+			t.Error("Result was expected to be stale.")
+		}
+	}
+	time.Sleep(time.Millisecond * 40)
+	if hdl.Handled() != 2 {
+		t.Error("Result was expected to be refreshed once.")
+	}
+	res, err = bus.Query(qry)
+	if err != nil {
+		t.Error(err.Error())
+	}
+	if res.IsStale() || !res.IsCached() {
+		t.Error("Result was expected to be refreshed.")
+	}
+
+	// after the stale duration the result is no longer used
+	time.Sleep(time.Millisecond * 400)
+	res, err = bus.Query(qry)
+	if err != nil {
+		t.Error(err.Error())
+	}
+	if res.IsStale() || !res.IsFresh() || hdl.Handled() != 3 {
+		t.Error("Result was expected to be fresh.")
+	}
+
+	// the refresh is limited by the query timeout
+	bus = NewBus()
+	hdl = &testCountingHandler{handled: new(uint32), delay: time.Millisecond * 100}
+	bus.Handlers(hdl)
+	qry = &testStaleCacheQuery{testCountingCacheQuery{key: "STALE-TIMEOUT"}}
+	if _, err = bus.Query(qry); err != nil {
+		t.Error(err.Error())
+	}
+	bus.QueryTimeout(time.Millisecond * 10)
+	time.Sleep(time.Millisecond * 60)
+	_, _ = bus.Query(qry)
+	time.Sleep(time.Millisecond * 30)
+	res, _ = bus.Query(qry)
+	time.Sleep(time.Millisecond * 10)
+	if !res.IsStale() || hdl.Handled() != 3 {
+		t.Error("Expected the timed out refresh to be retried.")
+	}
+}
+
+func TestBus_HandlerRouting(t *testing.T) {
+	bus := NewBus()
+	hdls := make([]Handler, 0, 1001)
+	hdls = append(hdls, &testSelectiveHandler{})
+	for i := 0; i < 1000; i++ {
+		// interleave catch-all and selective handlers
+		if i%2 == 0 {
+			hdls = append(hdls, &testHandlerOrder{position: uint32(i)})
+			continue
+		}
+		hdls = append(hdls, &testSelectiveHandlerOrder{testHandlerOrder{position: uint32(i)}})
+	}
+	bus.Handlers(hdls...)
+	if len(bus.handlerRouter.route(&testHandlerOrderQuery{})) != 1000 {
+		t.Error("Unexpected number of routed handlers.")
+	}
+	if len(bus.handlerRouter.route(&testQueryUnsupported{})) != 500 {
+		t.Error("Unexpected number of catch-all handlers.")
+	}
+
+	qry := &testHandlerOrderQuery{position: new(uint32), unordered: new(uint32)}
+	res, err := bus.Query(qry)
+	if err != nil {
+		t.Error(err.Error())
+	}
+	if qry.IsUnordered() {
+		t.Error("The Handler order MUST be respected.")
+	}
+	if len(res.All()) != 1000 {
+		t.Error("Query returned an unexpected number of values.")
+	}
+
+	res, err = bus.Query(&testQueryStruct{})
+	if err != nil {
+		t.Error(err.Error())
+	}
+	if res.First() != "foo" {
+		t.Error("Query returned an unexpected value.")
+	}
+
+	bus.InitializeIteratorHandlers(&testSelectiveIteratorHandler{}, &testIteratorHandler{})
+	itrRes, err := bus.IteratorQuery(testQueryString("test"))
+	if err != nil {
+		t.Error(err.Error())
+	}
+	if val := <-itrRes.Iterate(); val != "bar" {
+		t.Error("Query returned an unexpected value.")
+	}
+}
+
+func TestBus_EventListeners(t *testing.T) {
+	bus := NewBus()
+	lst := &storeEventsListener{}
+	bus.EventListeners(lst)
+	bus.Handlers(&testHandler{}, &testCountingHandler{handled: new(uint32)})
+	bus.IteratorListenerTimeout(time.Millisecond * 50)
+	bus.InitializeIteratorHandlers(&testIteratorHandler{})
+
+	qry := &testCountingCacheQuery{key: "EVENTS"}
+	if _, err := bus.Query(qry); err != nil {
+		t.Error(err.Error())
+	}
+	events := lst.Events()
+	if len(events) != 6 {
+		t.Fatalf("Unexpected number of events: %d.", len(events))
+	}
+	if _, ok := events[0].(QueryStarted); !ok {
+		t.Error("Expected QueryStarted event.")
+	}
+	if evt, ok := events[1].(CacheMiss); !ok || string(evt.CacheKey) != "EVENTS" {
+		t.Error("Expected CacheMiss event.")
+	}
+	if evt, ok := events[2].(HandlerInvoked); !ok || evt.HandlerIndex != 0 {
+		t.Error("Expected HandlerInvoked event.")
+	}
+	if evt, ok := events[3].(HandlerInvoked); !ok || evt.HandlerIndex != 1 || evt.Err != nil {
+		t.Error("Expected HandlerInvoked event.")
+	}
+	if evt, ok := events[4].(CacheStored); !ok || !evt.ExpiresAt.After(evt.At()) {
+		t.Error("Expected CacheStored event.")
+	}
+	if evt, ok := events[5].(QueryCompleted); !ok || evt.Cached || evt.Err != nil || evt.Query() != qry || evt.Duration <= 0 {
+		t.Error("Expected QueryCompleted event.")
+	}
+
+	if _, err := bus.Query(qry); err != nil {
+		t.Error(err.Error())
+	}
+	events = lst.Events()
+	if len(events) != 3 {
+		t.Fatalf("Unexpected number of events: %d.", len(events))
+	}
+	if evt, ok := events[1].(CacheHit); !ok || evt.Stale {
+		t.Error("Expected CacheHit event.")
+	}
+	if evt, ok := events[2].(QueryCompleted); !ok || !evt.Cached {
+		t.Error("Expected QueryCompleted event.")
+	}
+
+	if _, err := bus.Query(&testQueryEmptyResult{}); err != nil {
+		t.Error(err.Error())
+	}
+	events = lst.Events()
+	if evt, ok := events[2].(PropagationStopped); !ok || evt.HandlerIndex != 0 {
+		t.Error("Expected PropagationStopped event.")
+	}
+	if _, ok := events[3].(QueryCompleted); !ok || len(events) != 4 {
+		t.Error("Expected the propagation to stop after the first handler.")
+	}
+
+	res, err := bus.IteratorQuery(&testQueryStruct{})
+	if err != nil {
+		t.Error(err.Error())
+	}
+	time.Sleep(time.Millisecond * 100)
+	for range res.Iterate() {
+	}
+	events = lst.Events()
+	if _, ok := events[0].(IteratorEnqueued); !ok || len(events) != 2 {
+		t.Fatal("Expected IteratorEnqueued event.")
+	}
+	if evt, ok := events[1].(IteratorListenerTimedOut); !ok || evt.Timeout != time.Millisecond*50 {
+		t.Error("Expected IteratorListenerTimedOut event.")
+	}
+}
+
+func TestBus_Logger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	bus := NewBus()
+	bus.Logger(slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug})), slog.LevelDebug)
+	bus.Handlers(&testHandler{}, &testCountingHandler{handled: new(uint32)})
+
+	qry := &testCountingCacheQuery{key: "LOGGER"}
+	_, _ = bus.Query(qry)
+	_, _ = bus.Query(qry)
+	_, _ = bus.Query(&testQueryEmptyResult{})
+	bus.Shutdown()
+
+	out := buf.String()
+	expected := []string{
+		`level=DEBUG msg="query dispatched" query_type=*query.testCountingCacheQuery`,
+		`msg="query cache lookup" query_type=*query.testCountingCacheQuery query_id=UUID-COUNTING-CACHE cache_key=LOGGER hit=false stale=false`,
+		`msg="query handler invoked" query_type=*query.testCountingCacheQuery query_id=UUID-COUNTING-CACHE handler_index=0 handler_type=*query.testHandler decision=propagated`,
+		`handler_index=1 handler_type=*query.testCountingHandler decision=handled`,
+		`msg="query cache store" query_type=*query.testCountingCacheQuery query_id=UUID-COUNTING-CACHE cache_key=LOGGER stored=true`,
+		`cache_key=LOGGER hit=true stale=false`,
+		`msg="query completed" query_type=*query.testCountingCacheQuery query_id=UUID-COUNTING-CACHE duration=`,
+		`cached=true`,
+		`query_type=*query.testQueryEmptyResult query_id=UUID-EMPTY-RESULT handler_index=0 handler_type=*query.testHandler decision=done`,
+		`msg="query bus shutting down" iterator_workers=0`,
+		`msg="query bus shut down" duration=`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(out, line) {
+			t.Errorf("Expected the logs to contain %q.", line)
+		}
+	}
+
+	// the logs do not depend on the event listeners
+	buf.Reset()
+	lst := &storeEventsListener{}
+	bus.EventListeners(lst)
+	_, _ = bus.Query(qry)
+	if !strings.Contains(buf.String(), `cache_key=LOGGER hit=true stale=false`) {
+		t.Error("Expected the logs to contain the cache hit.")
+	}
+	hit := false
+	for _, evt := range lst.Events() {
+		if _, isHit := evt.(CacheHit); isHit {
+			hit = true
+		}
+	}
+	if !hit {
+		t.Error("Expected the listeners to receive the cache hit.")
+	}
+	bus.EventListeners()
+
+	// the level is respected
+	buf.Reset()
+	bus.Logger(slog.New(slog.NewTextHandler(buf, nil)), slog.LevelDebug)
+	_, _ = bus.Query(&testQueryStruct{})
+	if buf.Len() != 0 {
+		t.Error("Expected no logs below the level of the logger.")
+	}
+}
+
+func TestBus_QueryError(t *testing.T) {
+	bus := NewBus()
+	errHdl := &storeErrorsHandler{
+		errs: make(map[string]error),
+	}
+	bus.ErrorHandlers(errHdl)
+	bus.Handlers(&testHandler{}, &testHandlerWithErrors{}, &testSlowHandler{})
+
+	qry := &testQueryError{}
+	_, err := bus.Query(qry)
+	var qryErr QueryError
+	if !errors.As(err, &qryErr) {
+		t.Fatal("Expected QueryError error.")
+	}
+	if qryErr.Query() != qry || string(qryErr.QueryID()) != string(qry.ID()) || qryErr.Phase() != PhaseHandling {
+		t.Error("Unexpected QueryError query.")
+	}
+	if qryErr.HandlerIndex() != 1 || qryErr.HandlerType() != "*query.testHandlerWithErrors" || qryErr.Elapsed() <= 0 {
+		t.Error("Unexpected QueryError handler.")
+	}
+	if qryErr.Unwrap().Error() != "query failed" {
+		t.Error("Expected the handler error to be wrapped.")
+	}
+	if err.Error() != fmt.Sprintf("query: the handler %T (1) failed during the handling of the query %T: query failed", &testHandlerWithErrors{}, qry) {
+		t.Error("Unexpected QueryError message.")
+	}
+	if errHdl.Error(qry) != err {
+		t.Error("Expected the error handlers to receive the QueryError.")
+	}
+
+	// middlewares may provide errors of their own
+	cause := errors.New("unauthorized")
+	err = NewQueryError(qry, PhaseValidation, cause)
+	if !errors.Is(err, cause) || err.Error() != fmt.Sprintf("query: the validation of the query %T failed: unauthorized", qry) {
+		t.Error("Unexpected QueryError.")
+	}
+	if qryErr, ok := err.(QueryError); !ok || qryErr.HandlerIndex() != -1 || qryErr.Handler() != nil {
+		t.Error("Unexpected QueryError handler.")
+	}
+
+	// the validation errors are wrapped as well
+	_, err = bus.Query(nil)
+	if !errors.As(err, &qryErr) || qryErr.Phase() != PhaseValidation || !errors.Is(err, InvalidQueryError) {
+		t.Error("Expected the validation errors to be wrapped in a QueryError.")
+	}
+	if err.Error() != "query: the validation of the query <nil> failed: query: invalid query" {
+		t.Error("Unexpected QueryError message.")
+	}
+
+	// the errors of the bus provide their query
+	_, err = bus.Query(&testQueryUnsupported{})
+	if err, ok := err.(ErrorNoQueryHandlersFound); !ok || err.Query() == nil {
+		t.Error("Expected ErrorNoQueryHandlersFound error.")
+	}
+	_, err = bus.Query(&testTimeoutQuery{testSlowQuery{timeout: time.Millisecond}})
+	if err, ok := err.(ErrorQueryTimedOut); !ok || err.Query() == nil || !err.IsHandlingTimeout() {
+		t.Error("Expected ErrorQueryTimedOut error.")
+	}
+}
+
+func TestBus_PanicRecovery(t *testing.T) {
+	bus := NewBus()
+	errHdl := &storeErrorsHandler{
+		errs: make(map[string]error),
+	}
+	bus.ErrorHandlers(errHdl)
+	bus.PanicRecovery(true)
+	bus.Handlers(&testHandler{}, &testPanicHandler{})
+	bus.IteratorWorkerPoolSize(1)
+	bus.InitializeIteratorHandlers(&testPanicIteratorHandler{}, &testIteratorHandler{})
+
+	qry := &testPanicQuery{}
+	_, err := bus.Query(qry)
+	var pncErr ErrorHandlerPanicked
+	if !errors.As(err, &pncErr) {
+		t.Fatal("Expected ErrorHandlerPanicked error.")
+	}
+	if pncErr.Query() != qry || pncErr.Value() != "handler panicked" || !strings.Contains(pncErr.Stack(), "testPanicHandler") {
+		t.Error("Unexpected ErrorHandlerPanicked error.")
+	}
+	if pncErr.Error() != fmt.Sprintf("query: a handler panicked while handling the query %T: handler panicked", qry) {
+		t.Error("Unexpected ErrorHandlerPanicked message.")
+	}
+	if errHdl.Error(qry) != err {
+		t.Error("Expected the error handlers to receive the ErrorHandlerPanicked error.")
+	}
+
+	// the iterator workers survive the panics
+	for i := 0; i < 3; i++ {
+		res, err := bus.IteratorQuery(qry)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		for range res.Iterate() {
+		}
+		if !errors.As(res.Err(), &pncErr) || pncErr.Unwrap() == nil || pncErr.Unwrap().Error() != "iterator handler panicked" {
+			t.Error("Expected ErrorHandlerPanicked error.")
+		}
+	}
+	res, err := bus.IteratorQuery(&testQueryStruct{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if val := <-res.Iterate(); val != "bar" {
+		t.Error("Query returned an unexpected value.")
+	}
+	bus.Shutdown()
+
+	// without recovery the panics reach the caller, even when the handlers are executed in a separate goroutine
+	bus = NewBus()
+	bus.Handlers(&testPanicHandler{})
+	bus.QueryTimeout(time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for _, ctx := range []context.Context{context.Background(), ctx} {
+		func() {
+			defer func() {
+				if rec := recover(); rec != "handler panicked" {
+					t.Errorf("Expected the panic to reach the caller (recovered: %v).", rec)
+				}
+			}()
+			_, _ = bus.QueryContext(ctx, qry)
+		}()
+	}
+}
+
+func TestBus_RetryPolicy(t *testing.T) {
+	bus := NewBus()
+	errHdl := &storeErrorsHandler{
+		errs: make(map[string]error),
+	}
+	bus.ErrorHandlers(errHdl)
+	flakyHdl := &testFlakyHandler{failures: 2, attempts: new(uint32)}
+	bus.Handlers(&testHandler{}, flakyHdl)
+	bus.RetryPolicy(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, Jitter: 0.5})
+
+	qry := &testFlakyQuery{}
+	res, err := bus.Query(qry)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if flakyHdl.Attempts() != 3 || len(res.All()) != 1 || res.First() != uint32(3) {
+		t.Error("Expected the data of the failed attempts to be discarded.")
+	}
+	var qryErr QueryError
+	if !errors.As(errHdl.Error(qry), &qryErr) || qryErr.Attempts() != 2 || qryErr.HandlerIndex() != 1 {
+		t.Error("Expected the failed attempts to be provided to the error handlers.")
+	}
+
+	// the data replaced and the propagation stopped by the failed attempts are restored
+	flakyHdl = &testFlakyHandler{failures: 1, attempts: new(uint32), done: true}
+	bus.Handlers(&testFallbackHandler{}, flakyHdl, &testFallbackHandler{})
+	res, err = bus.Query(qry)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if fmt.Sprint(res.All()) != "[fallback 2 fallback]" {
+		t.Errorf("Expected the changes of the failed attempts to be discarded (data: %v).", res.All())
+	}
+
+	// the attempts are exhausted
+	flakyHdl = &testFlakyHandler{failures: 5, attempts: new(uint32)}
+	bus.Handlers(flakyHdl)
+	_, err = bus.Query(qry)
+	if !errors.As(err, &qryErr) || qryErr.Attempts() != 3 || flakyHdl.Attempts() != 3 {
+		t.Error("Expected the error to report the number of attempts.")
+	}
+	if err.Error() != fmt.Sprintf("query: the handler %T (0) failed during the handling of the query %T after 3 attempts: handler failed", flakyHdl, qry) {
+		t.Error("Unexpected QueryError message.")
+	}
+
+	// the policy may be overridden per query type
+	flakyHdl = &testFlakyHandler{failures: 5, attempts: new(uint32)}
+	bus.Handlers(flakyHdl)
+	bus.RetryPolicyFor(qry, RetryPolicy{
+		MaxAttempts: 5,
+		Retryable: func(err error) bool {
+			return false
+		},
+	})
+	_, err = bus.Query(qry)
+	if !errors.As(err, &qryErr) || qryErr.Attempts() != 1 || flakyHdl.Attempts() != 1 {
+		t.Error("Expected the error not to be retried.")
+	}
+
+	// the retries are abandoned once the context is done
+	flakyHdl = &testFlakyHandler{failures: 5, attempts: new(uint32)}
+	bus.Handlers(flakyHdl)
+	bus.RetryPolicyFor(qry, RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Second})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	start := time.Now()
+	_, err = bus.QueryContext(ctx, qry)
+	if _, ok := err.(ErrorQueryContextDone); !ok || time.Since(start) >= time.Second {
+		t.Error("Expected ErrorQueryContextDone error.")
+	}
+}
+
+func TestBus_Bulkhead(t *testing.T) {
+	bus := NewBus()
+	errHdl := &storeErrorsHandler{
+		errs: make(map[string]error),
+	}
+	bus.ErrorHandlers(errHdl)
+	hdl := &testCountingHandler{handled: new(uint32), delay: time.Millisecond * 100}
+	bus.Handlers(hdl)
+	bus.Bulkhead(&testCountingCacheQuery{}, BulkheadOptions{MaxConcurrent: 2, MaxQueued: 1})
+
+	wg := &sync.WaitGroup{}
+	errs := make([]error, 3)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = bus.Query(&testCountingCacheQuery{key: fmt.Sprintf("BULKHEAD-%d", i)})
+		}(i)
+	}
+	time.Sleep(time.Millisecond * 50)
+	if running, queued := bus.InFlight(&testCountingCacheQuery{}); running != 2 || queued != 1 {
+		t.Errorf("Unexpected in-flight queries (running: %d, queued: %d).", running, queued)
+	}
+	if running, queued := bus.InFlight(&testQueryStruct{}); running != 0 || queued != 0 {
+		t.Error("Expected no in-flight queries for types without bulkhead.")
+	}
+
+	// the queue is full
+	qry := &testCountingCacheQuery{key: "BULKHEAD-REJECTED"}
+	_, err := bus.Query(qry)
+	if err, ok := err.(ErrorQueryRejected); !ok || err.Limit() != 2 || err.Query() != qry {
+		t.Error("Expected ErrorQueryRejected error.")
+	}
+	if err.Error() != fmt.Sprintf("query: the query %T was rejected since the concurrency limit (2) of its type was reached", qry) {
+		t.Error("Unexpected ErrorQueryRejected message.")
+	}
+	if _, ok := errHdl.Error(qry).(ErrorQueryRejected); !ok {
+		t.Error("Expected the error handlers to receive the ErrorQueryRejected error.")
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Error(err.Error())
+		}
+	}
+	if hdl.Handled() != 3 {
+		t.Error("Expected the queued query to be handled.")
+	}
+	if running, queued := bus.InFlight(&testCountingCacheQuery{}); running != 0 || queued != 0 {
+		t.Error("Expected no in-flight queries.")
+	}
+
+	// the queued queries are rejected once the queue timeout elapses
+	bus.Bulkhead(&testCountingCacheQuery{}, BulkheadOptions{MaxConcurrent: 1, MaxQueued: 5, QueueTimeout: time.Millisecond * 20})
+	go func() {
+		_, _ = bus.Query(&testCountingCacheQuery{key: "BULKHEAD-SLOW"})
+	}()
+	time.Sleep(time.Millisecond * 10)
+	if _, err = bus.Query(&testCountingCacheQuery{key: "BULKHEAD-TIMEOUT"}); err == nil {
+		t.Error("Expected ErrorQueryRejected error.")
+	} else if _, ok := err.(ErrorQueryRejected); !ok {
+		t.Error("Expected ErrorQueryRejected error.")
+	}
+	// or once their context is done
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	_, err = bus.QueryContext(ctx, &testCountingCacheQuery{key: "BULKHEAD-CONTEXT"})
+	if _, ok := err.(ErrorQueryContextDone); !ok {
+		t.Error("Expected ErrorQueryContextDone error.")
+	}
+}
+
+func TestBus_RateLimit(t *testing.T) {
+	bus := NewBus()
+	errHdl := &storeErrorsHandler{
+		errs: make(map[string]error),
+	}
+	bus.ErrorHandlers(errHdl)
+	bus.Handlers(&testHandler{})
+	bus.RateLimit(&testQueryStruct{}, RateLimitOptions{Rate: 10, Burst: 2})
+
+	qry := &testQueryStruct{}
+	for i := 0; i < 2; i++ {
+		if _, err := bus.Query(qry); err != nil {
+			t.Error(err.Error())
+		}
+	}
+	_, err := bus.Query(qry)
+	if err, ok := err.(ErrorQueryRateLimited); !ok || err.Query() != qry || err.RetryAfter() <= 0 || err.RetryAfter() > time.Millisecond*100 {
+		t.Error("Expected ErrorQueryRateLimited error.")
+	}
+	if _, ok := errHdl.Error(qry).(ErrorQueryRateLimited); !ok {
+		t.Error("Expected the error handlers to receive the ErrorQueryRateLimited error.")
+	}
+	// other query types are not limited
+	if _, err = bus.Query(testQueryString("test")); err != nil {
+		t.Error(err.Error())
+	}
+
+	// the queries may wait for their turn
+	bus.RateLimit(&testQueryStruct{}, RateLimitOptions{Rate: 20, Wait: true, MaxWait: time.Millisecond * 100})
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err = bus.Query(qry); err != nil {
+			t.Error(err.Error())
+		}
+	}
+	if elapsed := time.Since(start); elapsed < time.Millisecond*90 {
+		t.Errorf("Expected the queries to wait for their turn, took %s.", elapsed)
+	}
+	// as long as allowed
+	bus.RateLimit(&testQueryStruct{}, RateLimitOptions{Rate: 1, Wait: true, MaxWait: time.Millisecond * 100})
+	_, _ = bus.Query(qry)
+	if _, err = bus.Query(qry); err == nil {
+		t.Error("Expected ErrorQueryRateLimited error.")
+	}
+	// or until the context is done
+	bus.RateLimit(&testQueryStruct{}, RateLimitOptions{Rate: 1, Wait: true})
+	_, _ = bus.Query(qry)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+	if _, err = bus.QueryContext(ctx, qry); err == nil {
+		t.Error("Expected ErrorQueryContextDone error.")
+	} else if _, ok := err.(ErrorQueryContextDone); !ok {
+		t.Error("Expected ErrorQueryContextDone error.")
+	}
+
+	// the queries may be limited by key
+	bus.RateLimit(&testRateLimitQuery{}, RateLimitOptions{Rate: 1})
+	for _, key := range []string{"A", "B"} {
+		if _, err = bus.Query(&testRateLimitQuery{key: key}); err != nil {
+			t.Error(err.Error())
+		}
+	}
+	if _, err = bus.Query(&testRateLimitQuery{key: "A"}); err == nil {
+		t.Error("Expected ErrorQueryRateLimited error.")
+	}
+}
+
+func TestBus_QueryAsync(t *testing.T) {
+	bus := NewBus()
+	errHdl := &storeErrorsHandler{
+		errs: make(map[string]error),
+	}
+	bus.ErrorHandlers(errHdl)
+	hdl := &testCountingHandler{handled: new(uint32), delay: time.Millisecond * 50}
+	bus.Handlers(&testHandler{}, hdl)
+	bus.AsyncWorkerPoolSize(2)
+
+	// the queries are executed concurrently by the workers
+	penRess := make([]*PendingResult, 4)
+	for i := range penRess {
+		penRess[i] = bus.QueryAsync(&testCountingCacheQuery{key: fmt.Sprintf("ASYNC-%d", i)})
+	}
+	select {
+	case <-penRess[0].Done():
+		t.Error("Expected the result to be pending.")
+	default:
+	}
+	time.Sleep(time.Millisecond * 25)
+	if hdl.Handled() != 2 {
+		t.Errorf("Expected the queries to be executed by 2 workers (handled: %d).", hdl.Handled())
+	}
+	for _, penRes := range penRess {
+		res, err := penRes.Wait()
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if res.First() != "bar" {
+			t.Error("Unexpected result.")
+		}
+	}
+
+	// the errors are returned by the pending result
+	if _, err := bus.QueryAsync(nil).Wait(); !errors.Is(err, InvalidQueryError) {
+		t.Error("Expected InvalidQueryError error.")
+	}
+	qry := &testQueryError{}
+	penRes := bus.QueryAsync(qry)
+	if penRes.Query() != qry {
+		t.Error("Unexpected pending query.")
+	}
+	if _, err := penRes.Wait(); err == nil {
+		t.Error("Expected the query to fail.")
+	} else if errHdl.Error(qry) == nil {
+		t.Error("Expected the error handlers to receive the error.")
+	}
+
+	// waiting may be abandoned while the query is still handled
+	penRes = bus.QueryAsync(&testCountingCacheQuery{key: "ASYNC-ABANDONED"})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	if _, err := penRes.WaitContext(ctx); err == nil {
+		t.Error("Expected ErrorQueryContextDone error.")
+	} else if _, ok := err.(ErrorQueryContextDone); !ok {
+		t.Error("Expected ErrorQueryContextDone error.")
+	}
+	if _, err := penRes.WaitContext(context.Background()); err != nil {
+		t.Error(err.Error())
+	}
+
+	// the queries enqueued are executed before the bus is shut down
+	penRes = bus.QueryAsync(&testCountingCacheQuery{key: "ASYNC-SHUTDOWN"})
+	bus.Shutdown()
+	select {
+	case <-penRes.Done():
+	default:
+		t.Error("Expected the query to be executed before shutting down.")
+	}
+
+	// the workers are not started again until the shutdown is finished
+	bus.asyncPool.stop()
+	penQry := &pendingAsyncQuery{ctx: context.Background(), qry: &testQueryStruct{}, res: newPendingResult(&testQueryStruct{})}
+	if err := bus.asyncPool.enqueue(context.Background(), penQry, bus.asyncWorker); err != BusIsShuttingDownError {
+		t.Error("Expected BusIsShuttingDownError error.")
+	}
+	if bus.asyncPool.workers != 0 {
+		t.Error("Expected the workers not to be started while shutting down.")
+	}
+	bus.asyncPool.reset()
+	if _, err := bus.QueryAsync(&testQueryStruct{}).Wait(); err != nil {
+		t.Error("Expected the workers to be started again.")
+	}
+	bus.Shutdown()
+}
+
+func TestBus_QueryAll(t *testing.T) {
+	bus := NewBus()
+	hdl := &testCountingHandler{handled: new(uint32)}
+	bus.Handlers(&testHandler{}, &testHandlerWithErrors{}, hdl)
+	middlewares := new(uint32)
+	bus.Use(func(next QueryFunc) QueryFunc {
+		return func(ctx context.Context, qry Query) (*Result, error) {
+			atomic.AddUint32(middlewares, 1)
+			return next(ctx, qry)
+		}
+	})
+	if _, err := bus.Query(&testCountingCacheQuery{key: "ALL-CACHED"}); err != nil {
+		t.Fatal(err.Error())
+	}
+	atomic.StoreUint32(middlewares, 0)
+
+	qrys := []Query{
+		&testQueryStruct{},
+		&testCountingCacheQuery{key: "ALL"},
+		&testQueryError{},
+		nil,
+		&testCountingCacheQuery{key: "ALL"},
+		&testCountingCacheQuery{key: "ALL-CACHED"},
+	}
+	ress, errs := bus.QueryAll(qrys...)
+	if len(ress) != len(qrys) || len(errs) != len(qrys) {
+		t.Fatal("Expected a result and an error for each query.")
+	}
+	for _, i := range []int{0, 1, 4, 5} {
+		if errs[i] != nil {
+			t.Error(errs[i].Error())
+		} else if ress[i].First() != "bar" {
+			t.Error("Unexpected result.")
+		}
+	}
+	if errs[2] == nil || ress[2] == nil {
+		t.Error("Expected the query to fail.")
+	}
+	if !errors.Is(errs[3], InvalidQueryError) || ress[3] != nil {
+		t.Error("Expected InvalidQueryError error.")
+	}
+	// the identical queries are handled once
+	if ress[1] != ress[4] || !ress[1].IsShared() {
+		t.Error("Expected the identical queries to share the result.")
+	}
+	if !ress[5].IsCached() {
+		t.Error("Expected the result to be retrieved from the cache.")
+	}
+	if hdl.Handled() != 2 {
+		t.Errorf("Expected the cacheable queries to be handled once (handled: %d).", hdl.Handled())
+	}
+	// the middlewares wrap every distinct query, including the cached ones
+	if atomic.LoadUint32(middlewares) != 4 {
+		t.Errorf("Expected the middlewares to wrap the queries (wrapped: %d).", atomic.LoadUint32(middlewares))
+	}
+	if res, err := bus.Query(&testCountingCacheQuery{key: "ALL"}); err != nil || !res.IsCached() || res.IsShared() {
+		t.Error("Expected the cached result not to be marked as shared.")
+	}
+
+	// the parallelism of the batch is bounded
+	hdl = &testCountingHandler{handled: new(uint32), delay: time.Millisecond * 50}
+	bus.Handlers(hdl)
+	bat := bus.Batch().Parallelism(2)
+	for i := 0; i < 4; i++ {
+		bat.Add(&testCountingCacheQuery{key: fmt.Sprintf("ALL-PARALLEL-%d", i)})
+	}
+	if bat.Len() != 4 {
+		t.Error("Unexpected batch length.")
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, errs = bat.Execute()
+	}()
+	time.Sleep(time.Millisecond * 25)
+	if hdl.Handled() != 2 {
+		t.Errorf("Expected 2 queries to be handled concurrently (handled: %d).", hdl.Handled())
+	}
+	<-done
+	for _, err := range errs {
+		if err != nil {
+			t.Error(err.Error())
+		}
+	}
+	if hdl.Handled() != 4 {
+		t.Error("Expected all the queries to be handled.")
+	}
+
+	// the context is provided to all the queries
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, errs = bus.QueryAllContext(ctx, &testCountingCacheQuery{key: "ALL-CANCELED"}, &testQueryStruct{})
+	for _, err := range errs {
+		if _, ok := err.(ErrorQueryContextDone); !ok {
+			t.Error("Expected ErrorQueryContextDone error.")
+		}
+	}
+
+	// the cache lookups are part of the queries, after the middlewares
+	lst := &storeEventsListener{}
+	bus.EventListeners(lst)
+	rec := NewSpanRecorder()
+	bus.Tracer(rec)
+	_, _ = bus.QueryAll(&testCountingCacheQuery{key: "ALL-EVENTS"})
+	events := lst.Events()
+	if len(events) < 2 {
+		t.Fatal("Expected the events of the query.")
+	}
+	if _, ok := events[0].(QueryStarted); !ok {
+		t.Error("Expected the query to start first.")
+	}
+	if _, ok := events[1].(CacheMiss); !ok {
+		t.Error("Expected the cache lookup to follow the start of the query.")
+	}
+	spans := rec.Spans()
+	if len(spans) < 2 || spans[0].Kind != SpanQuery || spans[1].Kind != SpanCacheGet || spans[1].ParentID != spans[0].ID {
+		t.Error("Expected the cache lookup span to be nested in the query span.")
+	}
+	bus.Use(func(next QueryFunc) QueryFunc {
+		return func(ctx context.Context, qry Query) (*Result, error) {
+			return nil, errors.New("short-circuited")
+		}
+	})
+	_, errs = bus.QueryAll(&testCountingCacheQuery{key: "ALL-SHORT-CIRCUITED"})
+	if errs[0] == nil {
+		t.Error("Expected the middleware to short-circuit the query.")
+	}
+	for _, evt := range lst.Events() {
+		if _, ok := evt.(CacheMiss); ok {
+			t.Error("Expected the cache not to be consulted for short-circuited queries.")
+		}
+	}
+}
+
 func BenchmarkBus_Query(b *testing.B) {
 	bus := NewBus()
 	bus.Handlers(&testHandler{})
@@ -7,3 +7,9 @@ type Cacheable interface {
 	CacheKey() []byte
 	CacheDuration() time.Duration
 }
+
+// Revalidatable may optionally be implemented by Cacheable queries to keep using their results after they expire.
+// During the stale duration, the expired result is returned immediately (marked as stale) while it is refreshed in the background.
+type Revalidatable interface {
+	StaleDuration() time.Duration
+}
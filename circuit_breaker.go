@@ -0,0 +1,219 @@
+package query
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// CircuitState is the state of a CircuitBreaker.
+type CircuitState uint8
+
+const (
+	// CircuitClosed is the state in which the handler is invoked normally.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen is the state in which the handler is skipped, so the queries propagate to the following handlers.
+	CircuitOpen
+	// CircuitHalfOpen is the state in which a single query at a time is provided to the handler, to verify if it recovered.
+	CircuitHalfOpen
+)
+
+// String returns the name of the CircuitState.
+func (state CircuitState) String() string {
+	switch state {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half_open"
+	}
+	return "unknown"
+}
+
+// CircuitBreakerOptions are used to configure a CircuitBreaker.
+type CircuitBreakerOptions struct {
+	// FailureThreshold is the number of consecutive failures after which the circuit opens. It defaults to 5.
+	FailureThreshold int
+	// CoolDown is the duration the circuit remains open before becoming half-open. It defaults to 30 seconds.
+	CoolDown time.Duration
+	// SuccessThreshold is the number of consecutive successes required for a half-open circuit to close. It defaults to 1.
+	SuccessThreshold int
+	// IsFailure determines which errors count as failures. All errors count if not provided.
+	IsFailure func(err error) bool
+}
+
+// CircuitBreaker wraps a handler, skipping it while its circuit is open.
+// Skipped handlers do not handle the query, so it propagates to the following (fallback) handlers.
+// Handlers implementing Selective should be preferred, otherwise unrelated queries also count as successes.
+type CircuitBreaker struct {
+	sync.Mutex
+	hdl       Handler
+	opts      CircuitBreakerOptions
+	state     CircuitState
+	failures  int
+	successes int
+	openedAt  time.Time
+	trial     bool
+	observers []circuitObserver
+}
+
+// circuitObserver is notified of the state changes of circuit breakers (the bus registers itself for its handlers).
+type circuitObserver interface {
+	circuitStateChanged(qry Query, cb *CircuitBreaker, from CircuitState, to CircuitState)
+}
+
+// NewCircuitBreaker creates a new *CircuitBreaker wrapping the provided handler.
+func NewCircuitBreaker(hdl Handler, opts CircuitBreakerOptions) *CircuitBreaker {
+	if opts.FailureThreshold <= 0 {
+		opts.FailureThreshold = 5
+	}
+	if opts.CoolDown <= 0 {
+		opts.CoolDown = 30 * time.Second
+	}
+	if opts.SuccessThreshold <= 0 {
+		opts.SuccessThreshold = 1
+	}
+	return &CircuitBreaker{
+		hdl:       hdl,
+		opts:      opts,
+		observers: make([]circuitObserver, 0, 1),
+	}
+}
+
+// Handle the query using the wrapped handler, unless the circuit is open.
+func (cb *CircuitBreaker) Handle(qry Query, res *Result) error {
+	return cb.HandleContext(context.Background(), qry, res)
+}
+
+// HandleContext handles the query using the wrapped handler (providing the context if it implements ContextHandler), unless the circuit is open.
+func (cb *CircuitBreaker) HandleContext(ctx context.Context, qry Query, res *Result) error {
+	if !cb.acquire(qry) {
+		return nil
+	}
+	completed := false
+	defer func() {
+		// the handler panicked
+		if !completed {
+			cb.release(qry, true)
+		}
+	}()
+
+	var err error
+	if hdl, implements := cb.hdl.(ContextHandler); implements {
+		err = hdl.HandleContext(ctx, qry, res)
+	} else {
+		err = cb.hdl.Handle(qry, res)
+	}
+	completed = true
+	cb.release(qry, err != nil && (cb.opts.IsFailure == nil || cb.opts.IsFailure(err)))
+	return err
+}
+
+// Handles returns the query types accepted by the wrapped handler, if it implements Selective.
+func (cb *CircuitBreaker) Handles() []Query {
+	if slt, implements := cb.hdl.(Selective); implements {
+		return slt.Handles()
+	}
+	return nil
+}
+
+// Handler returns the wrapped handler.
+func (cb *CircuitBreaker) Handler() Handler {
+	return cb.hdl
+}
+
+// State returns the current state of the circuit.
+func (cb *CircuitBreaker) State() CircuitState {
+	cb.Lock()
+	defer cb.Unlock()
+	return cb.state
+}
+
+//------Internal------//
+
+// acquire determines if the handler may be invoked, turning open circuits half-open once the cool-down elapses.
+func (cb *CircuitBreaker) acquire(qry Query) bool {
+	cb.Lock()
+	from := cb.state
+	switch cb.state {
+	case CircuitOpen:
+		if time.Since(cb.openedAt) < cb.opts.CoolDown {
+			cb.Unlock()
+			return false
+		}
+		cb.state = CircuitHalfOpen
+		cb.successes = 0
+		cb.trial = true
+	case CircuitHalfOpen:
+		// a single trial at a time
+		if cb.trial {
+			cb.Unlock()
+			return false
+		}
+		cb.trial = true
+	}
+	to := cb.state
+	cb.Unlock()
+	cb.notify(qry, from, to)
+	return true
+}
+
+// release records the outcome of the invocation of the handler.
+func (cb *CircuitBreaker) release(qry Query, failed bool) {
+	cb.Lock()
+	from := cb.state
+	switch cb.state {
+	case CircuitClosed:
+		if !failed {
+			cb.failures = 0
+			break
+		}
+		cb.failures++
+		if cb.failures >= cb.opts.FailureThreshold {
+			cb.open()
+		}
+	case CircuitHalfOpen:
+		cb.trial = false
+		if failed {
+			cb.open()
+			break
+		}
+		cb.successes++
+		if cb.successes >= cb.opts.SuccessThreshold {
+			cb.state = CircuitClosed
+			cb.failures = 0
+		}
+	}
+	to := cb.state
+	cb.Unlock()
+	cb.notify(qry, from, to)
+}
+
+func (cb *CircuitBreaker) open() {
+	cb.state = CircuitOpen
+	cb.openedAt = time.Now()
+}
+
+func (cb *CircuitBreaker) notify(qry Query, from CircuitState, to CircuitState) {
+	if from == to {
+		return
+	}
+	cb.Lock()
+	observers := cb.observers
+	cb.Unlock()
+	for _, obs := range observers {
+		obs.circuitStateChanged(qry, cb, from, to)
+	}
+}
+
+func (cb *CircuitBreaker) observe(obs circuitObserver) {
+	cb.Lock()
+	defer cb.Unlock()
+	for _, registered := range cb.observers {
+		if registered == obs {
+			return
+		}
+	}
+	cb.observers = append(cb.observers, obs)
+}
@@ -0,0 +1,111 @@
+package query
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	bus := NewBus()
+	errHdl := &storeCircuitStatesHandler{}
+	bus.ErrorHandlers(errHdl)
+	col := NewPrometheusCollector()
+	bus.MetricsCollector(col)
+	flakyHdl := &testFlakyHandler{failures: 2, attempts: new(uint32)}
+	cb := NewCircuitBreaker(flakyHdl, CircuitBreakerOptions{FailureThreshold: 2, CoolDown: time.Millisecond * 50})
+	bus.Handlers(cb, &testFallbackHandler{})
+
+	qry := &testFlakyQuery{}
+	for i := 0; i < 2; i++ {
+		if _, err := bus.Query(qry); err == nil {
+			t.Error("Query was expected to throw an error.")
+		}
+	}
+	if cb.State() != CircuitOpen {
+		t.Fatal("Expected the circuit to be open.")
+	}
+	stateErr := errHdl.Last()
+	if stateErr.Query() != qry || stateErr.From() != CircuitClosed || stateErr.To() != CircuitOpen || stateErr.Handler() != flakyHdl {
+		t.Error("Expected ErrorCircuitStateChanged error.")
+	}
+
+	// the open handler is skipped and the query propagates to the fallback
+	res, err := bus.Query(qry)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if res.First() != "fallback" || flakyHdl.Attempts() != 2 {
+		t.Error("Expected the handler to be skipped.")
+	}
+
+	// once the cool-down elapses, a trial closes the circuit
+	time.Sleep(time.Millisecond * 60)
+	res, err = bus.Query(qry)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if res.First() != uint32(3) || cb.State() != CircuitClosed {
+		t.Error("Expected the circuit to close.")
+	}
+	stateErr = errHdl.Last()
+	if stateErr.From() != CircuitHalfOpen || stateErr.To() != CircuitClosed {
+		t.Error("Expected ErrorCircuitStateChanged error.")
+	}
+	if stateErr.Error() != fmt.Sprintf("query: the circuit of the handler %T changed from half_open to closed while handling the query %T", flakyHdl, qry) {
+		t.Error("Unexpected ErrorCircuitStateChanged message.")
+	}
+
+	buf := &bytes.Buffer{}
+	_, _ = col.WriteTo(buf)
+	for _, state := range []string{"open", "half_open", "closed"} {
+		line := fmt.Sprintf(`query_bus_circuit_state_changes_total{handler_type="%T",state="%s"} 1`, flakyHdl, state)
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("Expected the metrics to contain %q.", line)
+		}
+	}
+}
+
+func TestCircuitBreaker_HalfOpen(t *testing.T) {
+	flakyHdl := &testFlakyHandler{failures: 3, attempts: new(uint32)}
+	cb := NewCircuitBreaker(flakyHdl, CircuitBreakerOptions{
+		FailureThreshold: 1,
+		CoolDown:         time.Millisecond * 20,
+		SuccessThreshold: 2,
+		IsFailure: func(err error) bool {
+			return err.Error() == "handler failed"
+		},
+	})
+
+	qry := &testFlakyQuery{}
+	_ = cb.Handle(qry, newResult())
+	if cb.State() != CircuitOpen {
+		t.Fatal("Expected the circuit to be open.")
+	}
+	// a failed trial opens the circuit again
+	time.Sleep(time.Millisecond * 30)
+	_ = cb.Handle(qry, newResult())
+	if cb.State() != CircuitOpen || flakyHdl.Attempts() != 2 {
+		t.Error("Expected the circuit to open again.")
+	}
+	// the circuit closes after the consecutive successes
+	time.Sleep(time.Millisecond * 30)
+	_ = cb.Handle(qry, newResult())
+	if cb.State() != CircuitOpen {
+		t.Error("Expected the circuit to open again.")
+	}
+	time.Sleep(time.Millisecond * 30)
+	_ = cb.Handle(qry, newResult())
+	if cb.State() != CircuitHalfOpen {
+		t.Error("Expected the circuit to remain half-open.")
+	}
+	_ = cb.Handle(qry, newResult())
+	if cb.State() != CircuitClosed {
+		t.Error("Expected the circuit to close.")
+	}
+	if cb.Handler() != flakyHdl || cb.Handles() != nil {
+		t.Error("Unexpected wrapped handler.")
+	}
+}
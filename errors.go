@@ -1,6 +1,9 @@
 package query
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 // ErrorInvalidQuery is used when invalid queries are handled.
 type ErrorInvalidQuery string
@@ -36,6 +39,11 @@ func (e ErrorNoQueryHandlersFound) Error() string {
 	return fmt.Sprintf("query: no handlers were found for the query %T", e.query)
 }
 
+// Query returns the query for which no handlers were found.
+func (e ErrorNoQueryHandlersFound) Query() Query {
+	return e.query
+}
+
 // NewErrorNoQueryHandlersFound creates a new ErrorNoQueryHandlersFound.
 func NewErrorNoQueryHandlersFound(query Query) ErrorNoQueryHandlersFound {
 	return ErrorNoQueryHandlersFound{query: query}
@@ -43,19 +51,349 @@ func NewErrorNoQueryHandlersFound(query Query) ErrorNoQueryHandlersFound {
 
 // ErrorQueryTimedOut is used when the handling of a query times out.
 type ErrorQueryTimedOut struct {
-	query Query
+	query    Query
+	timeout  time.Duration
+	handling bool
 }
 
 // Error returns the string message of ErrorQueryTimedOut.
 func (e ErrorQueryTimedOut) Error() string {
+	if e.handling {
+		return fmt.Sprintf("query: the handling of the query %T timed out after %s", e.query, e.timeout)
+	}
 	return fmt.Sprintf("query: the query %T timed out due to lack of result listeners. This may happen if a query was issued but the \"Iterate\" function of the result was not handled", e.query)
 }
 
-// NewErrorQueryTimedOut creates a new ErrorQueryTimedOut.
+// Query returns the query that timed out.
+func (e ErrorQueryTimedOut) Query() Query {
+	return e.query
+}
+
+// Timeout returns the duration after which the query timed out.
+func (e ErrorQueryTimedOut) Timeout() time.Duration {
+	return e.timeout
+}
+
+// IsHandlingTimeout verifies if the handling of the query timed out (as opposed to waiting for a result listener).
+func (e ErrorQueryTimedOut) IsHandlingTimeout() bool {
+	return e.handling
+}
+
+// NewErrorQueryTimedOut creates a new ErrorQueryTimedOut for iterator queries that lack result listeners.
+//
+// Deprecated: NewErrorQueryListenerTimedOut should be used instead, so the timeout is reported.
 func NewErrorQueryTimedOut(query Query) ErrorQueryTimedOut {
 	return ErrorQueryTimedOut{query: query}
 }
 
+// NewErrorQueryListenerTimedOut creates a new ErrorQueryTimedOut for iterator queries that lack result listeners.
+func NewErrorQueryListenerTimedOut(query Query, timeout time.Duration) ErrorQueryTimedOut {
+	return ErrorQueryTimedOut{query: query, timeout: timeout}
+}
+
+// NewErrorQueryHandlingTimedOut creates a new ErrorQueryTimedOut for queries whose handling exceeds the timeout.
+func NewErrorQueryHandlingTimedOut(query Query, timeout time.Duration) ErrorQueryTimedOut {
+	return ErrorQueryTimedOut{query: query, timeout: timeout, handling: true}
+}
+
+// ErrorQueryContextDone is used when the context of a query is done before the query is fully handled.
+type ErrorQueryContextDone struct {
+	query Query
+	err   error
+}
+
+// Error returns the string message of ErrorQueryContextDone.
+func (e ErrorQueryContextDone) Error() string {
+	return fmt.Sprintf("query: the context of the query %T is done: %s", e.query, e.err)
+}
+
+// Query returns the query whose context is done.
+func (e ErrorQueryContextDone) Query() Query {
+	return e.query
+}
+
+// Unwrap returns the error of the context (context.Canceled or context.DeadlineExceeded).
+func (e ErrorQueryContextDone) Unwrap() error {
+	return e.err
+}
+
+// NewErrorQueryContextDone creates a new ErrorQueryContextDone.
+func NewErrorQueryContextDone(query Query, err error) ErrorQueryContextDone {
+	return ErrorQueryContextDone{query: query, err: err}
+}
+
+// ErrorUnexpectedResultType is used when a result holds a value of a type other than the one expected.
+type ErrorUnexpectedResultType struct {
+	query    Query
+	value    interface{}
+	expected string
+}
+
+// Error returns the string message of ErrorUnexpectedResultType.
+func (e ErrorUnexpectedResultType) Error() string {
+	return fmt.Sprintf("query: the result of the query %T holds a value of type %T while %s was expected", e.query, e.value, e.expected)
+}
+
+// Query returns the query whose result holds the unexpected value.
+func (e ErrorUnexpectedResultType) Query() Query {
+	return e.query
+}
+
+// Value returns the value of the unexpected type.
+func (e ErrorUnexpectedResultType) Value() interface{} {
+	return e.value
+}
+
+// Expected returns the name of the type expected.
+func (e ErrorUnexpectedResultType) Expected() string {
+	return e.expected
+}
+
+// NewErrorUnexpectedResultType creates a new ErrorUnexpectedResultType.
+func NewErrorUnexpectedResultType(query Query, value interface{}, expected string) ErrorUnexpectedResultType {
+	return ErrorUnexpectedResultType{query: query, value: value, expected: expected}
+}
+
+// ErrorHandlerPanicked is used when a handler (or iterator handler) panics while handling a query.
+type ErrorHandlerPanicked struct {
+	query Query
+	value interface{}
+	stack string
+}
+
+// Error returns the string message of ErrorHandlerPanicked.
+func (e ErrorHandlerPanicked) Error() string {
+	return fmt.Sprintf("query: a handler panicked while handling the query %T: %v", e.query, e.value)
+}
+
+// Query returns the query being handled when the handler panicked.
+func (e ErrorHandlerPanicked) Query() Query {
+	return e.query
+}
+
+// Value returns the value provided to panic.
+func (e ErrorHandlerPanicked) Value() interface{} {
+	return e.value
+}
+
+// Stack returns the stack trace of the goroutine at the moment the panic was recovered.
+func (e ErrorHandlerPanicked) Stack() string {
+	return e.stack
+}
+
+// Unwrap returns the value provided to panic, whenever it is an error.
+func (e ErrorHandlerPanicked) Unwrap() error {
+	if err, isError := e.value.(error); isError {
+		return err
+	}
+	return nil
+}
+
+// NewErrorHandlerPanicked creates a new ErrorHandlerPanicked.
+func NewErrorHandlerPanicked(query Query, value interface{}, stack string) ErrorHandlerPanicked {
+	return ErrorHandlerPanicked{query: query, value: value, stack: stack}
+}
+
+// ErrorCircuitStateChanged is provided to the error handlers whenever the circuit of a CircuitBreaker changes state.
+type ErrorCircuitStateChanged struct {
+	query   Query
+	handler Handler
+	from    CircuitState
+	to      CircuitState
+}
+
+// Error returns the string message of ErrorCircuitStateChanged.
+func (e ErrorCircuitStateChanged) Error() string {
+	return fmt.Sprintf("query: the circuit of the handler %T changed from %s to %s while handling the query %T", e.handler, e.from, e.to, e.query)
+}
+
+// Query returns the query being handled when the circuit changed state.
+func (e ErrorCircuitStateChanged) Query() Query {
+	return e.query
+}
+
+// Handler returns the handler wrapped by the CircuitBreaker.
+func (e ErrorCircuitStateChanged) Handler() Handler {
+	return e.handler
+}
+
+// From returns the previous state of the circuit.
+func (e ErrorCircuitStateChanged) From() CircuitState {
+	return e.from
+}
+
+// To returns the current state of the circuit.
+func (e ErrorCircuitStateChanged) To() CircuitState {
+	return e.to
+}
+
+// NewErrorCircuitStateChanged creates a new ErrorCircuitStateChanged.
+func NewErrorCircuitStateChanged(query Query, handler Handler, from CircuitState, to CircuitState) ErrorCircuitStateChanged {
+	return ErrorCircuitStateChanged{query: query, handler: handler, from: from, to: to}
+}
+
+// ErrorQueryRejected is used when a query is rejected due to the concurrency limit of its type (bulkhead).
+type ErrorQueryRejected struct {
+	query Query
+	limit int
+}
+
+// Error returns the string message of ErrorQueryRejected.
+func (e ErrorQueryRejected) Error() string {
+	return fmt.Sprintf("query: the query %T was rejected since the concurrency limit (%d) of its type was reached", e.query, e.limit)
+}
+
+// Query returns the query that was rejected.
+func (e ErrorQueryRejected) Query() Query {
+	return e.query
+}
+
+// Limit returns the maximum number of queries of the same type handled concurrently.
+func (e ErrorQueryRejected) Limit() int {
+	return e.limit
+}
+
+// NewErrorQueryRejected creates a new ErrorQueryRejected.
+func NewErrorQueryRejected(query Query, limit int) ErrorQueryRejected {
+	return ErrorQueryRejected{query: query, limit: limit}
+}
+
+// ErrorQueryRateLimited is used when a query exceeds the rate limit of its type (or key).
+type ErrorQueryRateLimited struct {
+	query      Query
+	retryAfter time.Duration
+}
+
+// Error returns the string message of ErrorQueryRateLimited.
+func (e ErrorQueryRateLimited) Error() string {
+	return fmt.Sprintf("query: the query %T exceeded its rate limit, it may be retried after %s", e.query, e.retryAfter)
+}
+
+// Query returns the query that exceeded the rate limit.
+func (e ErrorQueryRateLimited) Query() Query {
+	return e.query
+}
+
+// RetryAfter returns the duration until the rate limit allows the query.
+func (e ErrorQueryRateLimited) RetryAfter() time.Duration {
+	return e.retryAfter
+}
+
+// NewErrorQueryRateLimited creates a new ErrorQueryRateLimited.
+func NewErrorQueryRateLimited(query Query, retryAfter time.Duration) ErrorQueryRateLimited {
+	return ErrorQueryRateLimited{query: query, retryAfter: retryAfter}
+}
+
+// Phase identifies the step of the querying process in which an error occurred.
+type Phase uint8
+
+const (
+	// PhaseValidation is the validation of the query (and of the state of the bus).
+	PhaseValidation Phase = iota
+	// PhaseHandling is the handling of a regular query.
+	PhaseHandling
+	// PhaseIteration is the handling of an iterator query.
+	PhaseIteration
+)
+
+// String returns the name of the Phase.
+func (phase Phase) String() string {
+	switch phase {
+	case PhaseValidation:
+		return "validation"
+	case PhaseHandling:
+		return "handling"
+	case PhaseIteration:
+		return "iteration"
+	}
+	return "unknown"
+}
+
+// QueryError wraps the errors returned by handlers (and iterator handlers) and the validation errors, providing the context in which they occurred.
+// The wrapped error can be inspected using errors.Is and errors.As.
+type QueryError struct {
+	query        Query
+	phase        Phase
+	handlerIndex int
+	handler      interface{}
+	attempts     int
+	elapsed      time.Duration
+	err          error
+}
+
+// Error returns the string message of QueryError.
+func (e QueryError) Error() string {
+	if e.attempts > 1 {
+		return fmt.Sprintf("query: the handler %T (%d) failed during the %s of the query %T after %d attempts: %s", e.handler, e.handlerIndex, e.phase, e.query, e.attempts, e.err)
+	}
+	if e.handler != nil {
+		return fmt.Sprintf("query: the handler %T (%d) failed during the %s of the query %T: %s", e.handler, e.handlerIndex, e.phase, e.query, e.err)
+	}
+	return fmt.Sprintf("query: the %s of the query %T failed: %s", e.phase, e.query, e.err)
+}
+
+// Unwrap returns the wrapped error.
+func (e QueryError) Unwrap() error {
+	return e.err
+}
+
+// Query returns the query during which the error occurred.
+func (e QueryError) Query() Query {
+	return e.query
+}
+
+// QueryID returns the ID of the query during which the error occurred.
+func (e QueryError) QueryID() []byte {
+	if e.query == nil {
+		return nil
+	}
+	return e.query.ID()
+}
+
+// Phase returns the step of the querying process in which the error occurred.
+func (e QueryError) Phase() Phase {
+	return e.phase
+}
+
+// HandlerIndex returns the position of the handler in the handlers provided to the bus (-1 if not applicable).
+func (e QueryError) HandlerIndex() int {
+	return e.handlerIndex
+}
+
+// Handler returns the handler (or iterator handler) that returned the error (nil if not applicable).
+func (e QueryError) Handler() interface{} {
+	return e.handler
+}
+
+// HandlerType returns the type of the handler that returned the error (empty if not applicable).
+func (e QueryError) HandlerType() string {
+	if e.handler == nil {
+		return ""
+	}
+	return fmt.Sprintf("%T", e.handler)
+}
+
+// Attempts returns the number of times the handler was invoked (0 if not applicable).
+// It exceeds 1 whenever the handler is retried according to a RetryPolicy.
+func (e QueryError) Attempts() int {
+	return e.attempts
+}
+
+// Elapsed returns the time elapsed since the phase started, until the error occurred.
+func (e QueryError) Elapsed() time.Duration {
+	return e.elapsed
+}
+
+// NewQueryError creates a new QueryError.
+// It may be used by middlewares to provide the context of their own errors.
+func NewQueryError(query Query, phase Phase, err error) QueryError {
+	return QueryError{query: query, phase: phase, handlerIndex: -1, err: err}
+}
+
+func newHandlerError(query Query, phase Phase, index int, hdl interface{}, attempts int, elapsed time.Duration, err error) QueryError {
+	return QueryError{query: query, phase: phase, handlerIndex: index, handler: hdl, attempts: attempts, elapsed: elapsed, err: err}
+}
+
 const (
 	// InvalidQueryError is a constant equivalent of the ErrorInvalidQuery error.
 	InvalidQueryError = ErrorInvalidQuery("query: invalid query")
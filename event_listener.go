@@ -0,0 +1,92 @@
+package query
+
+import "time"
+
+// EventListener may optionally be provided to the bus to receive the events of the querying process.
+// The events are provided synchronously, so listeners should avoid blocking.
+type EventListener interface {
+	Handle(evt Event)
+}
+
+// Event is implemented by all the events of the querying process.
+// Listeners may use a type switch to identify them.
+type Event interface {
+	Query() Query
+	At() time.Time
+}
+
+type event struct {
+	query Query
+	at    time.Time
+}
+
+// Query returns the query the event relates to.
+func (evt event) Query() Query {
+	return evt.query
+}
+
+// At returns the moment the event occurred.
+func (evt event) At() time.Time {
+	return evt.at
+}
+
+// QueryStarted is emitted once a regular query starts executing (before the middlewares).
+type QueryStarted struct {
+	event
+}
+
+// QueryCompleted is emitted once a regular query finishes executing (after the middlewares).
+type QueryCompleted struct {
+	event
+	Duration time.Duration
+	Cached   bool
+	Err      error
+}
+
+// HandlerInvoked is emitted once a handler (or iterator handler) returns.
+type HandlerInvoked struct {
+	event
+	// HandlerIndex is the position of the handler in the handlers provided to the bus.
+	HandlerIndex int
+	Handler      interface{}
+	Duration     time.Duration
+	Err          error
+}
+
+// PropagationStopped is emitted once a handler (or iterator handler) marks the result as Done.
+type PropagationStopped struct {
+	event
+	HandlerIndex int
+	Handler      interface{}
+}
+
+// CacheHit is emitted once the result of a Cacheable query is retrieved from a cache adapter.
+type CacheHit struct {
+	event
+	CacheKey []byte
+	Stale    bool
+}
+
+// CacheMiss is emitted once no cache adapter holds the result of a Cacheable query.
+type CacheMiss struct {
+	event
+	CacheKey []byte
+}
+
+// CacheStored is emitted once the result of a Cacheable query is stored by a cache adapter.
+type CacheStored struct {
+	event
+	CacheKey  []byte
+	ExpiresAt time.Time
+}
+
+// IteratorEnqueued is emitted once an iterator query is added to the iterator query queue.
+type IteratorEnqueued struct {
+	event
+}
+
+// IteratorListenerTimedOut is emitted once an iterator query is disregarded for lack of a listener.
+type IteratorListenerTimedOut struct {
+	event
+	Timeout time.Duration
+}
@@ -0,0 +1,144 @@
+package query
+
+import (
+	"container/heap"
+	"container/list"
+)
+
+// EvictionPolicy determines which results are evicted once a bounded MemoryCacheAdapter reaches its limits.
+type EvictionPolicy uint8
+
+const (
+	// EvictionLRU evicts the least recently used results first.
+	EvictionLRU EvictionPolicy = iota
+	// EvictionLFU evicts the least frequently used results first.
+	// Results used equally as often are evicted by recency.
+	EvictionLFU
+)
+
+// EvictionReason identifies why a result was evicted from a MemoryCacheAdapter.
+type EvictionReason uint8
+
+const (
+	// EvictionExpired is used when a result expired or was forcibly expired.
+	EvictionExpired EvictionReason = iota
+	// EvictionCapacity is used when a result was evicted to respect the limits of the adapter.
+	EvictionCapacity
+)
+
+type memoryCacheEntry struct {
+	key     string
+	res     *Result
+	size    int
+	hits    uint64
+	used    uint64
+	element *list.Element
+	index   int
+}
+
+// evictionIndex keeps track of the usage of the entries in order to determine the next one to be evicted.
+type evictionIndex interface {
+	push(ent *memoryCacheEntry)
+	touch(ent *memoryCacheEntry)
+	remove(ent *memoryCacheEntry)
+	victim() *memoryCacheEntry
+}
+
+func newEvictionIndex(policy EvictionPolicy) evictionIndex {
+	if policy == EvictionLFU {
+		return &lfuIndex{}
+	}
+	return &lruIndex{entries: list.New()}
+}
+
+//------LRU------//
+
+type lruIndex struct {
+	entries *list.List
+}
+
+func (idx *lruIndex) push(ent *memoryCacheEntry) {
+	ent.element = idx.entries.PushFront(ent)
+}
+
+func (idx *lruIndex) touch(ent *memoryCacheEntry) {
+	idx.entries.MoveToFront(ent.element)
+}
+
+func (idx *lruIndex) remove(ent *memoryCacheEntry) {
+	idx.entries.Remove(ent.element)
+}
+
+func (idx *lruIndex) victim() *memoryCacheEntry {
+	if el := idx.entries.Back(); el != nil {
+		return el.Value.(*memoryCacheEntry)
+	}
+	return nil
+}
+
+//------LFU------//
+
+type lfuIndex struct {
+	entries []*memoryCacheEntry
+	clock   uint64
+}
+
+func (idx *lfuIndex) push(ent *memoryCacheEntry) {
+	idx.clock++
+	ent.used = idx.clock
+	heap.Push(idx, ent)
+}
+
+func (idx *lfuIndex) touch(ent *memoryCacheEntry) {
+	idx.clock++
+	ent.hits++
+	ent.used = idx.clock
+	heap.Fix(idx, ent.index)
+}
+
+func (idx *lfuIndex) remove(ent *memoryCacheEntry) {
+	heap.Remove(idx, ent.index)
+}
+
+func (idx *lfuIndex) victim() *memoryCacheEntry {
+	if len(idx.entries) > 0 {
+		return idx.entries[0]
+	}
+	return nil
+}
+
+// Len is part of heap.Interface. It should not be used directly.
+func (idx *lfuIndex) Len() int {
+	return len(idx.entries)
+}
+
+// Less is part of heap.Interface. It should not be used directly.
+func (idx *lfuIndex) Less(i, j int) bool {
+	if idx.entries[i].hits == idx.entries[j].hits {
+		return idx.entries[i].used < idx.entries[j].used
+	}
+	return idx.entries[i].hits < idx.entries[j].hits
+}
+
+// Swap is part of heap.Interface. It should not be used directly.
+func (idx *lfuIndex) Swap(i, j int) {
+	idx.entries[i], idx.entries[j] = idx.entries[j], idx.entries[i]
+	idx.entries[i].index = i
+	idx.entries[j].index = j
+}
+
+// Push is part of heap.Interface. It should not be used directly.
+func (idx *lfuIndex) Push(x interface{}) {
+	ent := x.(*memoryCacheEntry)
+	ent.index = len(idx.entries)
+	idx.entries = append(idx.entries, ent)
+}
+
+// Pop is part of heap.Interface. It should not be used directly.
+func (idx *lfuIndex) Pop() interface{} {
+	n := len(idx.entries) - 1
+	ent := idx.entries[n]
+	idx.entries[n] = nil
+	idx.entries = idx.entries[:n]
+	return ent
+}
@@ -0,0 +1,74 @@
+package query
+
+import "sync"
+
+// flight represents the handling of a query in progress, which concurrent identical queries can wait for.
+type flight struct {
+	done      chan struct{}
+	followers int
+	abandoned bool
+	res       *Result
+	err       error
+}
+
+type flightGroup struct {
+	sync.Mutex
+	flights map[string]*flight
+}
+
+func newFlightGroup() *flightGroup {
+	return &flightGroup{
+		flights: make(map[string]*flight),
+	}
+}
+
+// join returns the flight in progress for the given key, or starts a new one.
+// The returned bool indicates whether the caller is the leader of the flight (and must land it).
+func (grp *flightGroup) join(key string) (*flight, bool) {
+	grp.Lock()
+	defer grp.Unlock()
+	if flt, inFlight := grp.flights[key]; inFlight {
+		flt.followers++
+		return flt, false
+	}
+	flt := &flight{done: make(chan struct{})}
+	grp.flights[key] = flt
+	return flt, true
+}
+
+// lead starts a new flight for the given key, unless one is already in progress.
+// The returned bool indicates whether the flight was started (and must be landed by the caller).
+func (grp *flightGroup) lead(key string) (*flight, bool) {
+	grp.Lock()
+	defer grp.Unlock()
+	if _, inFlight := grp.flights[key]; inFlight {
+		return nil, false
+	}
+	flt := &flight{done: make(chan struct{})}
+	grp.flights[key] = flt
+	return flt, true
+}
+
+// land completes the flight, releasing all its followers with the given result and error.
+// Whenever the flight had any followers, they are provided with a copy of the result marked as shared (which the leader should also use).
+func (grp *flightGroup) land(key string, flt *flight, res *Result, err error) *Result {
+	grp.Lock()
+	delete(grp.flights, key)
+	if flt.followers > 0 && res != nil {
+		res = res.sharedCopy()
+	}
+	grp.Unlock()
+	flt.res = res
+	flt.err = err
+	close(flt.done)
+	return res
+}
+
+// abandon the flight whose leader's context is done, releasing its followers so that one of them takes over.
+func (grp *flightGroup) abandon(key string, flt *flight) {
+	grp.Lock()
+	delete(grp.flights, key)
+	grp.Unlock()
+	flt.abandoned = true
+	close(flt.done)
+}
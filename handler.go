@@ -1,6 +1,14 @@
 package query
 
+import "context"
+
 // Handler must be implemented for a type to qualify as a query handler.
 type Handler interface {
 	Handle(qry Query, res *Result) error
 }
+
+// ContextHandler may optionally be implemented by query handlers to receive the context of the query.
+// Whenever implemented, HandleContext is used by the bus instead of Handle.
+type ContextHandler interface {
+	HandleContext(ctx context.Context, qry Query, res *Result) error
+}
@@ -1,6 +1,14 @@
 package query
 
+import "context"
+
 // IteratorHandler must be implemented for a type to qualify as an iterator query handler.
 type IteratorHandler interface {
 	Handle(qry Query, res *IteratorResult) error
 }
+
+// ContextIteratorHandler may optionally be implemented by iterator query handlers to receive the context of the query.
+// Whenever implemented, HandleContext is used by the bus instead of Handle.
+type ContextIteratorHandler interface {
+	HandleContext(ctx context.Context, qry Query, res *IteratorResult) error
+}
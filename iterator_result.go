@@ -1,28 +1,58 @@
 package query
 
-import "time"
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
 
 // IteratorResult is the struct returned from iterator queries.
 type IteratorResult struct {
 	resultCore
+	mutex     sync.Mutex
+	err       error
+	ctx       context.Context
+	cancel    context.CancelFunc
+	closing   *uint32
 	proxy     chan interface{}
 	listening chan bool
 }
 
-func newIteratorResult(buffer int) *IteratorResult {
-	return &IteratorResult{
+func newIteratorResult(ctx context.Context, buffer int) *IteratorResult {
+	res := &IteratorResult{
 		resultCore: newResultCore(),
+		closing:    new(uint32),
 		proxy:      make(chan interface{}, buffer),
 		listening:  make(chan bool, 1),
 	}
+	res.ctx, res.cancel = context.WithCancel(ctx)
+	return res
 }
 
 //------Provide Data------//
 
-// Yield is used to provide values while they are being processed
-func (res *IteratorResult) Yield(data interface{}) {
+// Yield is used to provide values while they are being processed.
+// It returns false whenever the value can no longer be consumed (the result was closed or the context of the query is done).
+// Handlers should stop yielding once false is returned.
+func (res *IteratorResult) Yield(data interface{}) bool {
 	res.Handled()
-	res.proxy <- data
+	select {
+	case <-res.ctx.Done():
+		return false
+	default:
+	}
+	select {
+	case res.proxy <- data:
+		return true
+	case <-res.ctx.Done():
+		return false
+	}
+}
+
+// IsClosed can be used by the handlers to verify if the consumer closed this result.
+func (res *IteratorResult) IsClosed() bool {
+	return atomic.LoadUint32(res.closing) == 1
 }
 
 //------Fetch Data------//
@@ -33,6 +63,22 @@ func (res *IteratorResult) Iterate() <-chan interface{} {
 	return res.proxy
 }
 
+// Err returns the error that terminated the handling of this result, if any.
+// This may be a QueryError (wrapping the error returned by a handler), ErrorNoQueryHandlersFound, ErrorQueryTimedOut or ErrorQueryContextDone.
+// It should be used once the iteration ends, to distinguish complete results from truncated ones.
+func (res *IteratorResult) Err() error {
+	res.mutex.Lock()
+	defer res.mutex.Unlock()
+	return res.err
+}
+
+// Close is used by the consumer to stop processing the values before the iteration ends.
+// The handlers are signaled to stop (Yield returns false and the context is canceled) and the propagation is stopped.
+func (res *IteratorResult) Close() {
+	atomic.CompareAndSwapUint32(res.closing, 0, 1)
+	res.cancel()
+}
+
 //------Internal------//
 
 func (res *IteratorResult) waitListener(timeout time.Duration) bool {
@@ -40,17 +86,35 @@ func (res *IteratorResult) waitListener(timeout time.Duration) bool {
 	case <-res.listening:
 		return true
 	default:
+		if timeout <= 0 {
+			select {
+			case <-res.listening:
+				return true
+			case <-res.ctx.Done():
+				return false
+			}
+		}
 		t := time.NewTimer(timeout)
 		select {
 		case <-res.listening:
 			t.Stop()
 			return true
+		case <-res.ctx.Done():
+			t.Stop()
+			return false
 		case <-t.C:
 			return false
 		}
 	}
 }
 
+func (res *IteratorResult) fail(err error) {
+	res.mutex.Lock()
+	res.err = err
+	res.mutex.Unlock()
+}
+
 func (res *IteratorResult) close() {
 	close(res.proxy)
+	res.cancel()
 }
@@ -0,0 +1,57 @@
+//go:build go1.23
+
+package query
+
+import "iter"
+
+// All returns an iterator over the values that are being yielded.
+// Breaking out of the loop closes the result, signaling the handlers to stop.
+// Err can be used once the loop ends to verify if the iteration was terminated by an error.
+func (res *IteratorResult) All() iter.Seq[interface{}] {
+	return func(yield func(interface{}) bool) {
+		for val := range res.Iterate() {
+			if !yield(val) {
+				res.Close()
+				return
+			}
+		}
+	}
+}
+
+// Seq2 returns an iterator over the index and the values that are being yielded.
+// Breaking out of the loop closes the result, signaling the handlers to stop.
+// Err can be used once the loop ends to verify if the iteration was terminated by an error.
+func (res *IteratorResult) Seq2() iter.Seq2[int, interface{}] {
+	return func(yield func(int, interface{}) bool) {
+		i := 0
+		for val := range res.Iterate() {
+			if !yield(i, val) {
+				res.Close()
+				return
+			}
+			i++
+		}
+	}
+}
+
+// Seq returns an iterator over the data slice.
+func (res *Result) Seq() iter.Seq[interface{}] {
+	return func(yield func(interface{}) bool) {
+		for _, val := range res.data {
+			if !yield(val) {
+				return
+			}
+		}
+	}
+}
+
+// Seq2 returns an iterator over the index and the values of the data slice.
+func (res *Result) Seq2() iter.Seq2[int, interface{}] {
+	return func(yield func(int, interface{}) bool) {
+		for i, val := range res.data {
+			if !yield(i, val) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,75 @@
+//go:build go1.23
+
+package query
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIteratorResult_All(t *testing.T) {
+	bus := NewBus()
+	hdl := &testInfiniteIteratorHandler{stopped: make(chan bool, 1)}
+	bus.InitializeIteratorHandlers(hdl, &testIteratorHandler{}, &testIteratorHandlerWithErrors{})
+
+	res, err := bus.IteratorQuery(&testQueryUnsupported{})
+	if err != nil {
+		t.Error(err.Error())
+	}
+	for val := range res.All() {
+		if val == 3 {
+			break
+		}
+	}
+	select {
+	case closed := <-hdl.stopped:
+		if !closed {
+			t.Error("Breaking out of the loop was expected to close the result.")
+		}
+	case <-time.After(time.Second):
+		t.Error("The handler was expected to stop yielding.")
+	}
+
+	res, err = bus.IteratorQuery(&testQueryStruct{})
+	if err != nil {
+		t.Error(err.Error())
+	}
+	for i, val := range res.Seq2() {
+		if i != 0 || val != "bar" {
+			t.Error("Query returned an unexpected value.")
+		}
+	}
+	if res.Err() != nil {
+		t.Error("The iteration was not expected to fail.")
+	}
+
+	res, err = bus.IteratorQuery(&testQueryError{})
+	if err != nil {
+		t.Error(err.Error())
+	}
+	for range res.All() {
+		t.Error("Query was not expected to yield values.")
+	}
+	if res.Err() == nil {
+		t.Error("The iteration was expected to fail.")
+	}
+}
+
+func TestResult_Seq(t *testing.T) {
+	res := newResult()
+	res.Add("foo")
+	res.Add("bar")
+	vals := make([]interface{}, 0)
+	for val := range res.Seq() {
+		vals = append(vals, val)
+	}
+	if len(vals) != 2 || vals[0] != "foo" || vals[1] != "bar" {
+		t.Error("Unexpected values.")
+	}
+	for i, val := range res.Seq2() {
+		if val != res.All()[i] {
+			t.Error("Unexpected value.")
+		}
+		break
+	}
+}
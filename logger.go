@@ -0,0 +1,63 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// SlogErrorHandler is an ErrorHandler logging the errors of the querying process using log/slog.
+type SlogErrorHandler struct {
+	logger *slog.Logger
+	level  slog.Level
+}
+
+// NewSlogErrorHandler creates a new *SlogErrorHandler logging the errors at the provided level.
+// The default logger (slog.Default()) is used if no logger is provided.
+func NewSlogErrorHandler(logger *slog.Logger, level slog.Level) *SlogErrorHandler {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &SlogErrorHandler{
+		logger: logger,
+		level:  level,
+	}
+}
+
+// Handle logs the error along with the type and ID of the query.
+func (hdl *SlogErrorHandler) Handle(qry Query, err error) {
+	ctx := context.Background()
+	if !hdl.logger.Enabled(ctx, hdl.level) {
+		return
+	}
+	attrs := append(queryAttrs(qry), slog.Any("error", err))
+	hdl.logger.LogAttrs(ctx, hdl.level, "query failed", attrs...)
+}
+
+// queryAttrs describes the query using structured attributes.
+func queryAttrs(qry Query) []slog.Attr {
+	if qry == nil {
+		return []slog.Attr{slog.String("query_type", "nil")}
+	}
+	return []slog.Attr{
+		slog.String("query_type", fmt.Sprintf("%T", qry)),
+		slog.String("query_id", string(qry.ID())),
+	}
+}
+
+// handlingState is implemented by both the Result and the IteratorResult.
+type handlingState interface {
+	propagationStopped() bool
+	isHandled() bool
+}
+
+// handlerDecision describes the state of the result once a handler returns.
+func handlerDecision(res handlingState) string {
+	if res.propagationStopped() {
+		return "done"
+	}
+	if res.isHandled() {
+		return "handled"
+	}
+	return "propagated"
+}
@@ -0,0 +1,32 @@
+package query
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSlogErrorHandler(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := slog.New(slog.NewTextHandler(buf, nil))
+	bus := NewBus()
+	bus.ErrorHandlers(NewSlogErrorHandler(logger, slog.LevelWarn))
+	bus.Handlers(&testHandlerWithErrors{})
+
+	_, _ = bus.Query(&testQueryError{})
+	out := buf.String()
+	for _, exp := range []string{"level=WARN", `msg="query failed"`, "query_type=*query.testQueryError", "query_id=", "error="} {
+		if !strings.Contains(out, exp) {
+			t.Errorf("Expected the log to contain %q, got %q.", exp, out)
+		}
+	}
+
+	// the level is respected
+	buf.Reset()
+	NewSlogErrorHandler(logger, slog.LevelDebug).Handle(&testQueryError{}, errors.New("test"))
+	if buf.Len() != 0 {
+		t.Error("Expected the error not to be logged.")
+	}
+}
@@ -6,53 +6,139 @@ import (
 	"time"
 )
 
+// MemoryCacheAdapterOptions may optionally be provided to bound a MemoryCacheAdapter.
+type MemoryCacheAdapterOptions struct {
+	// MaxEntries limits the number of cached results. Zero means unlimited.
+	MaxEntries int
+	// MaxBytes limits the approximate size (in bytes) of the cached results. Zero means unlimited.
+	MaxBytes int
+	// EvictionPolicy determines which results are evicted once a limit is reached. It defaults to EvictionLRU.
+	EvictionPolicy EvictionPolicy
+	// Sizer may optionally be provided to approximate the size (in bytes) of the cached results.
+	// By default the size is approximated by the cache key and the values of the data slice.
+	Sizer func(key []byte, res *Result) int
+	// OnEvict may optionally be provided to be notified of every evicted result.
+	OnEvict func(key []byte, res *Result, reason EvictionReason)
+}
+
 // MemoryCacheAdapter is the struct used for memory caching purposes.
 type MemoryCacheAdapter struct {
 	sync.RWMutex
-	cachedResults map[string]*Result
+	options       MemoryCacheAdapterOptions
+	cachedResults map[string]*memoryCacheEntry
+	index         evictionIndex
+	bytes         int
 	cleanerSignal chan bool
 	shuttingDown  *uint32
 	sleepTimer    *time.Timer
 	sleepUntil    time.Time
 }
 
-// NewMemoryCacheAdapter initializes a new *MemoryCacheAdapter.
+// NewMemoryCacheAdapter initializes a new unbounded *MemoryCacheAdapter.
 // This function will also initialize the respective cleaner routine.
 func NewMemoryCacheAdapter() *MemoryCacheAdapter {
+	return NewMemoryCacheAdapterWithOptions(MemoryCacheAdapterOptions{})
+}
+
+// NewMemoryCacheAdapterWithOptions initializes a new *MemoryCacheAdapter bounded by the provided options.
+// This function will also initialize the respective cleaner routine.
+func NewMemoryCacheAdapterWithOptions(opts MemoryCacheAdapterOptions) *MemoryCacheAdapter {
+	if opts.Sizer == nil {
+		opts.Sizer = approximateResultSize
+	}
 	ad := &MemoryCacheAdapter{
-		cachedResults: make(map[string]*Result),
+		options:       opts,
+		cachedResults: make(map[string]*memoryCacheEntry),
 		cleanerSignal: make(chan bool, 1),
 		shuttingDown:  new(uint32),
 	}
+	if opts.MaxEntries > 0 || opts.MaxBytes > 0 {
+		ad.index = newEvictionIndex(opts.EvictionPolicy)
+	}
 	go ad.cleaner()
 	return ad
 }
 
 // Set stores the cache value for the given query.
+// Results larger than the MaxBytes option are not stored.
 func (ad *MemoryCacheAdapter) Set(qry Cacheable, res *Result) bool {
+	key := qry.CacheKey()
+	ent := &memoryCacheEntry{
+		key: string(key),
+		res: res,
+	}
+	if ad.options.MaxBytes > 0 {
+		ent.size = ad.options.Sizer(key, res)
+		if ent.size > ad.options.MaxBytes {
+			return false
+		}
+	}
+
 	ad.Lock()
-	ad.cachedResults[string(qry.CacheKey())] = res
+	if prev, isCached := ad.cachedResults[ent.key]; isCached {
+		ad.remove(prev)
+	}
+	evicted := ad.makeRoom(ent)
+	ad.cachedResults[ent.key] = ent
+	ad.bytes += ent.size
+	if ad.index != nil {
+		ad.index.push(ent)
+	}
 	ad.Unlock()
+
+	ad.evicted(evicted, EvictionCapacity)
 	ad.clean()
 	return true
 }
 
 // Get retrieves the cached result for the provided query.
 func (ad *MemoryCacheAdapter) Get(qry Cacheable) *Result {
-	ad.RLock()
-	res := ad.cachedResults[string(qry.CacheKey())]
-	ad.RUnlock()
-	return res
+	if ad.index == nil {
+		ad.RLock()
+		defer ad.RUnlock()
+		if ent, isCached := ad.cachedResults[string(qry.CacheKey())]; isCached {
+			return ent.res
+		}
+		return nil
+	}
+
+	// bounded adapters keep track of the usage of the results
+	ad.Lock()
+	defer ad.Unlock()
+	if ent, isCached := ad.cachedResults[string(qry.CacheKey())]; isCached {
+		ad.index.touch(ent)
+		return ent.res
+	}
+	return nil
 }
 
 // Expire can optionally be used to forcibly expire a query cache.
 func (ad *MemoryCacheAdapter) Expire(qry Cacheable) {
 	ck := string(qry.CacheKey())
 	ad.Lock()
-	if _, isCached := ad.cachedResults[ck]; isCached {
-		delete(ad.cachedResults, ck)
+	ent, isCached := ad.cachedResults[ck]
+	if isCached {
+		ad.remove(ent)
 	}
 	ad.Unlock()
+	if isCached {
+		ad.evicted([]*memoryCacheEntry{ent}, EvictionExpired)
+	}
+}
+
+// Len returns the number of cached results.
+func (ad *MemoryCacheAdapter) Len() int {
+	ad.RLock()
+	defer ad.RUnlock()
+	return len(ad.cachedResults)
+}
+
+// Bytes returns the approximate size (in bytes) of the cached results.
+// It is only tracked when the MaxBytes option is provided.
+func (ad *MemoryCacheAdapter) Bytes() int {
+	ad.RLock()
+	defer ad.RUnlock()
+	return ad.bytes
 }
 
 // Shutdown is used to stop the cleaner routine.
@@ -67,16 +153,20 @@ func (ad *MemoryCacheAdapter) cleaner() {
 	for atomic.LoadUint32(ad.shuttingDown) == 0 {
 		now := time.Now()
 		ad.sleepUntil = time.Time{}
+		expired := make([]*memoryCacheEntry, 0)
 		ad.Lock()
-		for key, res := range ad.cachedResults {
-			if !res.CachedAt().IsZero() && now.After(res.ExpiresAt()) {
-				delete(ad.cachedResults, key)
+		for _, ent := range ad.cachedResults {
+			if !ent.res.CachedAt().IsZero() && now.After(ent.res.StaleUntil()) {
+				ad.remove(ent)
+				expired = append(expired, ent)
 				continue
 			}
-			ad.updateSleepUntil(res.ExpiresAt())
+			ad.updateSleepUntil(ent.res.StaleUntil())
 		}
+		sleep := ad.determineSleepDuration()
 		ad.Unlock()
-		ad.updateSleepTimer(ad.determineSleepDuration())
+		ad.evicted(expired, EvictionExpired)
+		ad.updateSleepTimer(sleep)
 
 		// allow the cleaner to be triggered either with timer or directly
 		select {
@@ -90,6 +180,45 @@ func (ad *MemoryCacheAdapter) clean() {
 	select {case ad.cleanerSignal <- true: default:}
 }
 
+// makeRoom evicts results until the given entry fits within the limits of the adapter.
+func (ad *MemoryCacheAdapter) makeRoom(ent *memoryCacheEntry) []*memoryCacheEntry {
+	if ad.index == nil {
+		return nil
+	}
+	evicted := make([]*memoryCacheEntry, 0)
+	for ad.exceedsLimits(ent) {
+		victim := ad.index.victim()
+		if victim == nil {
+			break
+		}
+		ad.remove(victim)
+		evicted = append(evicted, victim)
+	}
+	return evicted
+}
+
+func (ad *MemoryCacheAdapter) exceedsLimits(ent *memoryCacheEntry) bool {
+	return (ad.options.MaxEntries > 0 && len(ad.cachedResults)+1 > ad.options.MaxEntries) ||
+		(ad.options.MaxBytes > 0 && ad.bytes+ent.size > ad.options.MaxBytes)
+}
+
+func (ad *MemoryCacheAdapter) remove(ent *memoryCacheEntry) {
+	delete(ad.cachedResults, ent.key)
+	ad.bytes -= ent.size
+	if ad.index != nil {
+		ad.index.remove(ent)
+	}
+}
+
+func (ad *MemoryCacheAdapter) evicted(ents []*memoryCacheEntry, reason EvictionReason) {
+	if ad.options.OnEvict == nil {
+		return
+	}
+	for _, ent := range ents {
+		ad.options.OnEvict([]byte(ent.key), ent.res, reason)
+	}
+}
+
 func (ad *MemoryCacheAdapter) updateSleepUntil(expiresAt time.Time) {
 	if ad.sleepUntil.IsZero() || expiresAt.Before(ad.sleepUntil) {
 		ad.sleepUntil = expiresAt
@@ -111,3 +240,29 @@ func (ad *MemoryCacheAdapter) updateSleepTimer(d time.Duration) {
 	}
 	ad.sleepTimer.Reset(d)
 }
+
+// approximateResultSize approximates the memory used by a result, its cache key and the values of its data slice.
+func approximateResultSize(key []byte, res *Result) int {
+	const resultOverhead, valueOverhead = 128, 16
+	size := resultOverhead + len(key)
+	for _, val := range res.All() {
+		size += valueOverhead
+		switch val := val.(type) {
+		case string:
+			size += len(val)
+		case []byte:
+			size += len(val)
+		case bool, int8, uint8:
+			size++
+		case int16, uint16:
+			size += 2
+		case int32, uint32, float32:
+			size += 4
+		case int, uint, int64, uint64, float64, uintptr:
+			size += 8
+		default:
+			size += valueOverhead
+		}
+	}
+	return size
+}
@@ -0,0 +1,146 @@
+package query
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryCacheAdapter_MaxEntriesLRU(t *testing.T) {
+	evicted := make(map[string]EvictionReason)
+	adt := NewMemoryCacheAdapterWithOptions(MemoryCacheAdapterOptions{
+		MaxEntries: 2,
+		OnEvict: func(key []byte, res *Result, reason EvictionReason) {
+			evicted[string(key)] = reason
+		},
+	})
+	defer adt.Shutdown()
+
+	adt.Set(&testCountingCacheQuery{key: "A"}, newResult())
+	adt.Set(&testCountingCacheQuery{key: "B"}, newResult())
+	// use A so that B becomes the least recently used
+	if adt.Get(&testCountingCacheQuery{key: "A"}) == nil {
+		t.Error("Result was expected to be cached.")
+	}
+	adt.Set(&testCountingCacheQuery{key: "C"}, newResult())
+
+	if adt.Len() != 2 {
+		t.Error("Unexpected number of cached results.")
+	}
+	if adt.Get(&testCountingCacheQuery{key: "B"}) != nil {
+		t.Error("Result was expected to be evicted.")
+	}
+	if reason, isEvicted := evicted["B"]; !isEvicted || reason != EvictionCapacity {
+		t.Error("Expected the eviction callback with EvictionCapacity.")
+	}
+	if adt.Get(&testCountingCacheQuery{key: "A"}) == nil || adt.Get(&testCountingCacheQuery{key: "C"}) == nil {
+		t.Error("Result was expected to be cached.")
+	}
+
+	adt.Expire(&testCountingCacheQuery{key: "A"})
+	if reason, isEvicted := evicted["A"]; !isEvicted || reason != EvictionExpired {
+		t.Error("Expected the eviction callback with EvictionExpired.")
+	}
+}
+
+func TestMemoryCacheAdapter_MaxEntriesLFU(t *testing.T) {
+	adt := NewMemoryCacheAdapterWithOptions(MemoryCacheAdapterOptions{
+		MaxEntries:     2,
+		EvictionPolicy: EvictionLFU,
+	})
+	defer adt.Shutdown()
+
+	adt.Set(&testCountingCacheQuery{key: "A"}, newResult())
+	adt.Set(&testCountingCacheQuery{key: "B"}, newResult())
+	// A is used more often, although B is the most recently used
+	adt.Get(&testCountingCacheQuery{key: "A"})
+	adt.Get(&testCountingCacheQuery{key: "A"})
+	adt.Get(&testCountingCacheQuery{key: "B"})
+	adt.Set(&testCountingCacheQuery{key: "C"}, newResult())
+
+	if adt.Get(&testCountingCacheQuery{key: "B"}) != nil {
+		t.Error("Result was expected to be evicted.")
+	}
+	if adt.Get(&testCountingCacheQuery{key: "A"}) == nil || adt.Get(&testCountingCacheQuery{key: "C"}) == nil {
+		t.Error("Result was expected to be cached.")
+	}
+}
+
+func TestMemoryCacheAdapter_MaxBytes(t *testing.T) {
+	adt := NewMemoryCacheAdapterWithOptions(MemoryCacheAdapterOptions{
+		MaxBytes: 100,
+		Sizer: func(key []byte, res *Result) int {
+			return len(res.First().(string))
+		},
+	})
+	defer adt.Shutdown()
+
+	res := newResult()
+	res.Add(string(make([]byte, 101)))
+	if adt.Set(&testCountingCacheQuery{key: "TOO-LARGE"}, res) {
+		t.Error("Result was not expected to be cached.")
+	}
+
+	for _, key := range []string{"A", "B", "C"} {
+		res = newResult()
+		res.Add(string(make([]byte, 40)))
+		if !adt.Set(&testCountingCacheQuery{key: key}, res) {
+			t.Error("Result was expected to be cached.")
+		}
+	}
+	if adt.Len() != 2 || adt.Bytes() != 80 {
+		t.Error("Unexpected size of cached results.")
+	}
+	if adt.Get(&testCountingCacheQuery{key: "A"}) != nil {
+		t.Error("Result was expected to be evicted.")
+	}
+
+	// replacing a result must not count its previous size
+	res = newResult()
+	res.Add(string(make([]byte, 61)))
+	adt.Set(&testCountingCacheQuery{key: "C"}, res)
+	if adt.Len() != 1 || adt.Bytes() != 61 {
+		t.Error("Unexpected size of cached results.")
+	}
+
+	// the default sizer counts the cache key once
+	adt = NewMemoryCacheAdapterWithOptions(MemoryCacheAdapterOptions{MaxBytes: 1000})
+	defer adt.Shutdown()
+	qry := &testCountingCacheQuery{key: "KEY"}
+	res = newCacheableResult(qry)
+	res.Add("abc")
+	adt.Set(qry, res)
+	if adt.Bytes() != 128+3+16+3 {
+		t.Errorf("Unexpected size of cached results (bytes: %d).", adt.Bytes())
+	}
+}
+
+func TestMemoryCacheAdapter_Expiry(t *testing.T) {
+	mutex := &sync.Mutex{}
+	evicted := make([]EvictionReason, 0)
+	adt := NewMemoryCacheAdapterWithOptions(MemoryCacheAdapterOptions{
+		MaxEntries: 10,
+		OnEvict: func(key []byte, res *Result, reason EvictionReason) {
+			mutex.Lock()
+			evicted = append(evicted, reason)
+			mutex.Unlock()
+		},
+	})
+	defer adt.Shutdown()
+
+	at := time.Now()
+	res := newResult()
+	res.expires(at.Add(time.Millisecond * 10))
+	res.cached(at)
+	adt.Set(&testCountingCacheQuery{key: "A"}, res)
+	time.Sleep(time.Millisecond * 100)
+
+	if adt.Get(&testCountingCacheQuery{key: "A"}) != nil {
+		t.Error("Result was expected to expire.")
+	}
+	mutex.Lock()
+	if len(evicted) != 1 || evicted[0] != EvictionExpired {
+		t.Error("Expected the eviction callback with EvictionExpired.")
+	}
+	mutex.Unlock()
+}
@@ -0,0 +1,44 @@
+package query
+
+import "time"
+
+// MetricsCollector may optionally be provided to the bus to collect metrics of the querying process.
+type MetricsCollector interface {
+	// QueryHandled is called once a regular query (not found in the cache) returns, with the error returned to the caller.
+	// Queries abandoned because their context is done are reported as soon as they are abandoned, and queries not admitted (rejected by a bulkhead or rate limited) are reported as well.
+	QueryHandled(qry Query, duration time.Duration, err error)
+	// CacheLookup is called once the cache adapters are consulted for a Cacheable query.
+	CacheLookup(qry Query, hit bool)
+	// CacheStored is called once the result of a Cacheable query is provided to the cache adapters.
+	CacheStored(qry Query, stored bool)
+	// IteratorQueryHandled is called once the iterator workers finish handling an iterator query.
+	// The wait is the duration the query spent in the iterator query queue.
+	IteratorQueryHandled(qry Query, wait time.Duration, duration time.Duration, err error)
+	// IteratorQueue is called whenever the number of iterator workers or the length of the iterator query queue changes.
+	IteratorQueue(workers int, length int)
+}
+
+// CircuitBreakerCollector may optionally be implemented by metrics collectors to collect the state changes of circuit breakers.
+type CircuitBreakerCollector interface {
+	// CircuitStateChanged is called whenever the circuit of a CircuitBreaker (wrapping the handler) changes state.
+	CircuitStateChanged(hdl Handler, from CircuitState, to CircuitState)
+}
+
+// outcome classifies the error of a query for metrics purposes.
+func outcome(err error) string {
+	switch err.(type) {
+	case nil:
+		return "success"
+	case ErrorQueryTimedOut:
+		return "timeout"
+	case ErrorQueryContextDone:
+		return "canceled"
+	case ErrorNoQueryHandlersFound:
+		return "unhandled"
+	case ErrorQueryRejected:
+		return "rejected"
+	case ErrorQueryRateLimited:
+		return "rate_limited"
+	}
+	return "error"
+}
@@ -0,0 +1,100 @@
+package query
+
+import (
+	"context"
+	"reflect"
+)
+
+// QueryFunc is the function used to execute regular queries.
+type QueryFunc func(ctx context.Context, qry Query) (*Result, error)
+
+// Middleware wraps the execution of regular queries.
+// Middlewares may short-circuit the execution by not calling next.
+type Middleware func(next QueryFunc) QueryFunc
+
+// IteratorQueryFunc is the function used to execute iterator queries.
+type IteratorQueryFunc func(ctx context.Context, qry Query) (*IteratorResult, error)
+
+// IteratorMiddleware wraps the execution of iterator queries.
+// Iterator middlewares may short-circuit the execution by not calling next.
+type IteratorMiddleware func(next IteratorQueryFunc) IteratorQueryFunc
+
+func middlewareFuncs(mws []Middleware) []func(QueryFunc) QueryFunc {
+	fns := make([]func(QueryFunc) QueryFunc, len(mws))
+	for i, mw := range mws {
+		fns[i] = mw
+	}
+	return fns
+}
+
+func iteratorMiddlewareFuncs(mws []IteratorMiddleware) []func(IteratorQueryFunc) IteratorQueryFunc {
+	fns := make([]func(IteratorQueryFunc) IteratorQueryFunc, len(mws))
+	for i, mw := range mws {
+		fns[i] = mw
+	}
+	return fns
+}
+
+// middlewareChain composes the global and the per query type middlewares around the execution function F.
+// The composition is performed whenever middlewares are provided, so it is not repeated for every query.
+type middlewareChain[F any] struct {
+	core          F
+	global        []func(F) F
+	typed         map[reflect.Type][]func(F) F
+	compiled      F
+	compiledTyped map[reflect.Type]F
+}
+
+func newMiddlewareChain[F any](core F) *middlewareChain[F] {
+	return &middlewareChain[F]{
+		core:          core,
+		global:        make([]func(F) F, 0),
+		typed:         make(map[reflect.Type][]func(F) F),
+		compiled:      core,
+		compiledTyped: make(map[reflect.Type]F),
+	}
+}
+
+// use appends the middlewares to the chain of the query type, or to the global chain if no query is provided.
+func (chn *middlewareChain[F]) use(qry Query, mws ...func(F) F) {
+	if qry == nil {
+		chn.global = append(chn.global, mws...)
+	} else {
+		typ := reflect.TypeOf(qry)
+		chn.typed[typ] = append(chn.typed[typ], mws...)
+	}
+	chn.compile()
+}
+
+func (chn *middlewareChain[F]) compile() {
+	chn.compiled = chn.wrap(nil, chn.core)
+	chn.compiledTyped = make(map[reflect.Type]F, len(chn.typed))
+	for typ, mws := range chn.typed {
+		chn.compiledTyped[typ] = wrap(chn.global, wrap(mws, chn.core))
+	}
+}
+
+// wrap composes the middlewares of the query type around the given function.
+func (chn *middlewareChain[F]) wrap(qry Query, fn F) F {
+	if qry != nil {
+		fn = wrap(chn.typed[reflect.TypeOf(qry)], fn)
+	}
+	return wrap(chn.global, fn)
+}
+
+func (chn *middlewareChain[F]) get(qry Query) F {
+	if len(chn.compiledTyped) > 0 {
+		if fn, typed := chn.compiledTyped[reflect.TypeOf(qry)]; typed {
+			return fn
+		}
+	}
+	return chn.compiled
+}
+
+// wrap composes the middlewares around the function, so that the first middleware is the outermost.
+func wrap[F any](mws []func(F) F, fn F) F {
+	for i := len(mws) - 1; i >= 0; i-- {
+		fn = mws[i](fn)
+	}
+	return fn
+}
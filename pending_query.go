@@ -1,6 +1,19 @@
 package query
 
+import (
+	"context"
+	"time"
+)
+
 type pendingIteratorQuery struct {
+	qry        Query
+	res        *IteratorResult
+	wait       Span
+	enqueuedAt time.Time
+}
+
+type pendingAsyncQuery struct {
+	ctx context.Context
 	qry Query
-	res *IteratorResult
+	res *PendingResult
 }
@@ -0,0 +1,54 @@
+package query
+
+import (
+	"context"
+)
+
+// PendingResult is returned from asynchronous queries (QueryAsync function of the bus).
+// It represents the result of a query which may still be handled.
+type PendingResult struct {
+	qry  Query
+	done chan struct{}
+	res  *Result
+	err  error
+}
+
+func newPendingResult(qry Query) *PendingResult {
+	return &PendingResult{
+		qry:  qry,
+		done: make(chan struct{}),
+	}
+}
+
+// Query returns the query the result is pending for.
+func (penRes *PendingResult) Query() Query {
+	return penRes.qry
+}
+
+// Done returns a channel which is closed once the query is fully handled.
+func (penRes *PendingResult) Done() <-chan struct{} {
+	return penRes.done
+}
+
+// Wait for the query to be fully handled, returning the same result and error as the QueryContext function of the bus.
+func (penRes *PendingResult) Wait() (*Result, error) {
+	<-penRes.done
+	return penRes.res, penRes.err
+}
+
+// WaitContext waits for the query to be fully handled, unless the context is done first.
+// In that case an ErrorQueryContextDone error is returned, while the query keeps being handled (it may be waited for again).
+func (penRes *PendingResult) WaitContext(ctx context.Context) (*Result, error) {
+	select {
+	case <-penRes.done:
+		return penRes.res, penRes.err
+	case <-ctx.Done():
+		return nil, NewErrorQueryContextDone(penRes.qry, ctx.Err())
+	}
+}
+
+func (penRes *PendingResult) resolve(res *Result, err error) {
+	penRes.res = res
+	penRes.err = err
+	close(penRes.done)
+}
@@ -0,0 +1,267 @@
+package query
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultPrometheusBuckets are the histogram buckets (in seconds) used by the PrometheusCollector by default.
+var DefaultPrometheusBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// PrometheusCollector is a MetricsCollector that keeps the metrics in memory.
+// The metrics are labelled by query type and outcome, and can be rendered in the Prometheus text exposition format.
+type PrometheusCollector struct {
+	sync.Mutex
+	queries             *counterVec
+	queryDuration       *histogramVec
+	cacheLookups        *counterVec
+	cacheStores         *counterVec
+	iteratorQueries     *counterVec
+	iteratorDuration    *histogramVec
+	iteratorWait        *histogramVec
+	circuitStates       *counterVec
+	iteratorWorkers     int
+	iteratorQueueLength int
+}
+
+// NewPrometheusCollector creates a new *PrometheusCollector.
+// The histogram buckets (in seconds) may optionally be provided, otherwise DefaultPrometheusBuckets are used.
+func NewPrometheusCollector(buckets ...float64) *PrometheusCollector {
+	if len(buckets) == 0 {
+		buckets = DefaultPrometheusBuckets
+	}
+	return &PrometheusCollector{
+		queries:          newCounterVec("query_bus_queries_total", "The number of regular queries handled.", "query_type", "outcome"),
+		queryDuration:    newHistogramVec("query_bus_query_duration_seconds", "The duration of the handling of regular queries.", buckets, "query_type", "outcome"),
+		cacheLookups:     newCounterVec("query_bus_cache_lookups_total", "The number of cache lookups of cacheable queries.", "query_type", "result"),
+		cacheStores:      newCounterVec("query_bus_cache_stores_total", "The number of results of cacheable queries provided to the cache adapters.", "query_type", "result"),
+		iteratorQueries:  newCounterVec("query_bus_iterator_queries_total", "The number of iterator queries handled.", "query_type", "outcome"),
+		iteratorDuration: newHistogramVec("query_bus_iterator_query_duration_seconds", "The duration of the handling of iterator queries.", buckets, "query_type", "outcome"),
+		iteratorWait:     newHistogramVec("query_bus_iterator_queue_wait_seconds", "The duration iterator queries spent in the queue.", buckets, "query_type"),
+		circuitStates:    newCounterVec("query_bus_circuit_state_changes_total", "The number of state changes of the circuit breakers.", "handler_type", "state"),
+	}
+}
+
+// QueryHandled is used by the bus to collect the metrics of a regular query.
+func (col *PrometheusCollector) QueryHandled(qry Query, duration time.Duration, err error) {
+	typ, out := fmt.Sprintf("%T", qry), outcome(err)
+	col.Lock()
+	col.queries.inc(typ, out)
+	col.queryDuration.observe(duration.Seconds(), typ, out)
+	col.Unlock()
+}
+
+// CacheLookup is used by the bus to collect the cache hits and misses.
+func (col *PrometheusCollector) CacheLookup(qry Query, hit bool) {
+	res := "miss"
+	if hit {
+		res = "hit"
+	}
+	typ := fmt.Sprintf("%T", qry)
+	col.Lock()
+	col.cacheLookups.inc(typ, res)
+	col.Unlock()
+}
+
+// CacheStored is used by the bus to collect the results provided to the cache adapters.
+func (col *PrometheusCollector) CacheStored(qry Query, stored bool) {
+	res := "rejected"
+	if stored {
+		res = "stored"
+	}
+	typ := fmt.Sprintf("%T", qry)
+	col.Lock()
+	col.cacheStores.inc(typ, res)
+	col.Unlock()
+}
+
+// IteratorQueryHandled is used by the bus to collect the metrics of an iterator query.
+func (col *PrometheusCollector) IteratorQueryHandled(qry Query, wait time.Duration, duration time.Duration, err error) {
+	typ, out := fmt.Sprintf("%T", qry), outcome(err)
+	col.Lock()
+	col.iteratorQueries.inc(typ, out)
+	col.iteratorDuration.observe(duration.Seconds(), typ, out)
+	col.iteratorWait.observe(wait.Seconds(), typ)
+	col.Unlock()
+}
+
+// IteratorQueue is used by the bus to collect the number of iterator workers and the length of the iterator query queue.
+func (col *PrometheusCollector) IteratorQueue(workers int, length int) {
+	col.Lock()
+	col.iteratorWorkers = workers
+	col.iteratorQueueLength = length
+	col.Unlock()
+}
+
+// CircuitStateChanged is used by the bus to collect the state changes of the circuit breakers.
+func (col *PrometheusCollector) CircuitStateChanged(hdl Handler, from CircuitState, to CircuitState) {
+	typ := fmt.Sprintf("%T", hdl)
+	col.Lock()
+	col.circuitStates.inc(typ, to.String())
+	col.Unlock()
+}
+
+// WriteTo renders the metrics in the Prometheus text exposition format.
+func (col *PrometheusCollector) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	col.Lock()
+	col.queries.write(cw)
+	col.queryDuration.write(cw)
+	col.cacheLookups.write(cw)
+	col.cacheStores.write(cw)
+	col.iteratorQueries.write(cw)
+	col.iteratorDuration.write(cw)
+	col.iteratorWait.write(cw)
+	col.circuitStates.write(cw)
+	writeGauge(cw, "query_bus_iterator_workers", "The number of iterator workers.", col.iteratorWorkers)
+	writeGauge(cw, "query_bus_iterator_queue_length", "The number of iterator queries waiting in the queue.", col.iteratorQueueLength)
+	col.Unlock()
+	if cw.err == nil {
+		cw.err = cw.w.(*bufio.Writer).Flush()
+	}
+	return cw.n, cw.err
+}
+
+//------Internal------//
+
+type counterVec struct {
+	name       string
+	help       string
+	labelNames []string
+	values     map[string]*counterValue
+}
+
+type counterValue struct {
+	labels []string
+	value  uint64
+}
+
+func newCounterVec(name string, help string, labelNames ...string) *counterVec {
+	return &counterVec{
+		name:       name,
+		help:       help,
+		labelNames: labelNames,
+		values:     make(map[string]*counterValue),
+	}
+}
+
+func (vec *counterVec) inc(labels ...string) {
+	key := strings.Join(labels, "\xff")
+	val, exists := vec.values[key]
+	if !exists {
+		val = &counterValue{labels: labels}
+		vec.values[key] = val
+	}
+	val.value++
+}
+
+func (vec *counterVec) write(w *countingWriter) {
+	w.printf("# HELP %s %s\n# TYPE %s counter\n", vec.name, vec.help, vec.name)
+	for _, key := range sortedKeys(vec.values) {
+		val := vec.values[key]
+		w.printf("%s{%s} %d\n", vec.name, formatLabels(vec.labelNames, val.labels), val.value)
+	}
+}
+
+type histogramVec struct {
+	name       string
+	help       string
+	labelNames []string
+	buckets    []float64
+	values     map[string]*histogramValue
+}
+
+type histogramValue struct {
+	labels []string
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newHistogramVec(name string, help string, buckets []float64, labelNames ...string) *histogramVec {
+	return &histogramVec{
+		name:       name,
+		help:       help,
+		labelNames: labelNames,
+		buckets:    buckets,
+		values:     make(map[string]*histogramValue),
+	}
+}
+
+func (vec *histogramVec) observe(v float64, labels ...string) {
+	key := strings.Join(labels, "\xff")
+	val, exists := vec.values[key]
+	if !exists {
+		val = &histogramValue{labels: labels, counts: make([]uint64, len(vec.buckets))}
+		vec.values[key] = val
+	}
+	for i, bound := range vec.buckets {
+		if v <= bound {
+			val.counts[i]++
+		}
+	}
+	val.sum += v
+	val.count++
+}
+
+func (vec *histogramVec) write(w *countingWriter) {
+	w.printf("# HELP %s %s\n# TYPE %s histogram\n", vec.name, vec.help, vec.name)
+	for _, key := range sortedKeys(vec.values) {
+		val := vec.values[key]
+		labels := formatLabels(vec.labelNames, val.labels)
+		for i, bound := range vec.buckets {
+			w.printf("%s_bucket{%s,le=\"%s\"} %d\n", vec.name, labels, formatFloat(bound), val.counts[i])
+		}
+		w.printf("%s_bucket{%s,le=\"+Inf\"} %d\n", vec.name, labels, val.count)
+		w.printf("%s_sum{%s} %s\n", vec.name, labels, formatFloat(val.sum))
+		w.printf("%s_count{%s} %d\n", vec.name, labels, val.count)
+	}
+}
+
+func writeGauge(w *countingWriter, name string, help string, value int) {
+	w.printf("# HELP %s %s\n# TYPE %s gauge\n%s %d\n", name, help, name, name, value)
+}
+
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (w *countingWriter) printf(format string, args ...interface{}) {
+	if w.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(w.w, format, args...)
+	w.n += int64(n)
+	w.err = err
+}
+
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(names []string, values []string) string {
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + labelValueReplacer.Replace(values[i]) + `"`
+	}
+	return strings.Join(pairs, ",")
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
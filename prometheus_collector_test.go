@@ -0,0 +1,139 @@
+package query
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPrometheusCollector(t *testing.T) {
+	bus := NewBus()
+	col := NewPrometheusCollector(0.1, 1)
+	bus.MetricsCollector(col)
+	bus.Handlers(&testHandler{}, &testHandlerWithErrors{}, &testCountingHandler{handled: new(uint32)})
+	bus.IteratorWorkerPoolSize(2)
+	bus.InitializeIteratorHandlers(&testIteratorHandler{})
+
+	_, _ = bus.Query(&testQueryStruct{})
+	_, _ = bus.Query(&testQueryError{})
+	_, _ = bus.Query(&testQueryUnsupported{})
+	_, _ = bus.Query(&testCountingCacheQuery{key: "METRICS"})
+	_, _ = bus.Query(&testCountingCacheQuery{key: "METRICS"})
+	res, _ := bus.IteratorQuery(&testQueryStruct{})
+	for range res.Iterate() {
+	}
+	time.Sleep(time.Millisecond * 10)
+
+	buf := &bytes.Buffer{}
+	n, err := col.WriteTo(buf)
+	if err != nil {
+		t.Error(err.Error())
+	}
+	if int(n) != buf.Len() {
+		t.Error("Unexpected number of bytes written.")
+	}
+	out := buf.String()
+	expected := []string{
+		"# TYPE query_bus_queries_total counter",
+		fmt.Sprintf(`query_bus_queries_total{query_type="%T",outcome="success"} 1`, &testQueryStruct{}),
+		fmt.Sprintf(`query_bus_queries_total{query_type="%T",outcome="error"} 1`, &testQueryError{}),
+		fmt.Sprintf(`query_bus_queries_total{query_type="%T",outcome="unhandled"} 1`, &testQueryUnsupported{}),
+		"# TYPE query_bus_query_duration_seconds histogram",
+		fmt.Sprintf(`query_bus_query_duration_seconds_bucket{query_type="%T",outcome="success",le="0.1"} 1`, &testQueryStruct{}),
+		fmt.Sprintf(`query_bus_query_duration_seconds_bucket{query_type="%T",outcome="success",le="+Inf"} 1`, &testQueryStruct{}),
+		fmt.Sprintf(`query_bus_query_duration_seconds_count{query_type="%T",outcome="success"} 1`, &testQueryStruct{}),
+		fmt.Sprintf(`query_bus_cache_lookups_total{query_type="%T",result="hit"} 1`, &testCountingCacheQuery{}),
+		fmt.Sprintf(`query_bus_cache_lookups_total{query_type="%T",result="miss"} 1`, &testCountingCacheQuery{}),
+		fmt.Sprintf(`query_bus_cache_stores_total{query_type="%T",result="stored"} 1`, &testCountingCacheQuery{}),
+		fmt.Sprintf(`query_bus_iterator_queries_total{query_type="%T",outcome="success"} 1`, &testQueryStruct{}),
+		fmt.Sprintf(`query_bus_iterator_queue_wait_seconds_count{query_type="%T"} 1`, &testQueryStruct{}),
+		"# TYPE query_bus_iterator_workers gauge\nquery_bus_iterator_workers 2",
+		"query_bus_iterator_queue_length 0",
+	}
+	for _, line := range expected {
+		if !strings.Contains(out, line) {
+			t.Errorf("Expected the metrics to contain %q.", line)
+		}
+	}
+
+	bus.Shutdown()
+	buf.Reset()
+	_, _ = col.WriteTo(buf)
+	if !strings.Contains(buf.String(), "query_bus_iterator_workers 0") {
+		t.Error("Expected no iterator workers after shutdown.")
+	}
+}
+
+func TestPrometheusCollector_Outcomes(t *testing.T) {
+	bus := NewBus()
+	col := NewPrometheusCollector()
+	bus.MetricsCollector(col)
+	bus.Handlers(&testSlowHandler{})
+
+	// the outcome is the one returned to the caller
+	qry := &testTimeoutQuery{testSlowQuery{timeout: time.Millisecond * 20}}
+	if _, err := bus.Query(qry); err == nil {
+		t.Error("Expected ErrorQueryTimedOut error.")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+	_, _ = bus.QueryContext(ctx, &testSlowQuery{})
+
+	buf := &bytes.Buffer{}
+	_, _ = col.WriteTo(buf)
+	expected := []string{
+		fmt.Sprintf(`query_bus_queries_total{query_type="%T",outcome="timeout"} 1`, qry),
+		fmt.Sprintf(`query_bus_queries_total{query_type="%T",outcome="canceled"} 1`, &testSlowQuery{}),
+	}
+	for _, line := range expected {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("Expected the metrics to contain %q.", line)
+		}
+	}
+	if strings.Contains(buf.String(), `outcome="success"`) {
+		t.Error("Expected no successful queries.")
+	}
+}
+
+func TestPrometheusCollector_Admission(t *testing.T) {
+	bus := NewBus()
+	col := NewPrometheusCollector()
+	bus.MetricsCollector(col)
+	bus.Handlers(&testSlowHandler{})
+	bus.Bulkhead(&testSlowQuery{}, BulkheadOptions{MaxConcurrent: 1})
+	bus.RateLimit(&testTimeoutQuery{}, RateLimitOptions{Rate: 1})
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, _ = bus.Query(&testSlowQuery{})
+	}()
+	time.Sleep(time.Millisecond * 50)
+	if _, err := bus.Query(&testSlowQuery{}); err == nil {
+		t.Error("Expected ErrorQueryRejected error.")
+	}
+	wg.Wait()
+	_, _ = bus.Query(&testTimeoutQuery{})
+	if _, err := bus.Query(&testTimeoutQuery{}); err == nil {
+		t.Error("Expected ErrorQueryRateLimited error.")
+	}
+
+	buf := &bytes.Buffer{}
+	_, _ = col.WriteTo(buf)
+	expected := []string{
+		fmt.Sprintf(`query_bus_queries_total{query_type="%T",outcome="success"} 1`, &testSlowQuery{}),
+		fmt.Sprintf(`query_bus_queries_total{query_type="%T",outcome="rejected"} 1`, &testSlowQuery{}),
+		fmt.Sprintf(`query_bus_queries_total{query_type="%T",outcome="success"} 1`, &testTimeoutQuery{}),
+		fmt.Sprintf(`query_bus_queries_total{query_type="%T",outcome="rate_limited"} 1`, &testTimeoutQuery{}),
+	}
+	for _, line := range expected {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("Expected the metrics to contain %q.", line)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package query
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimitable may optionally be implemented by queries to be rate limited by key (e.g. per caller), instead of by type only.
+// Queries of the same type sharing the same key share the same token bucket.
+type RateLimitable interface {
+	RateLimitKey() []byte
+}
+
+// RateLimitOptions are used to configure the rate limit (token bucket) of the regular queries of a given type.
+type RateLimitOptions struct {
+	// Rate is the number of queries allowed per second.
+	Rate float64
+	// Burst is the maximum number of queries allowed at once (the size of the bucket). It defaults to 1.
+	Burst int
+	// Wait determines if queries exceeding the rate wait for their turn, instead of failing fast.
+	Wait bool
+	// MaxWait limits how long queries wait for their turn, the ones that would wait longer fail fast.
+	// It defaults to 0 (queries wait until their context is done).
+	MaxWait time.Duration
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type rateLimiter struct {
+	sync.Mutex
+	opts    RateLimitOptions
+	buckets map[string]*tokenBucket
+	sweepAt int
+}
+
+func newRateLimiter(opts RateLimitOptions) *rateLimiter {
+	if opts.Burst <= 0 {
+		opts.Burst = 1
+	}
+	return &rateLimiter{
+		opts:    opts,
+		buckets: make(map[string]*tokenBucket),
+		sweepAt: 1024,
+	}
+}
+
+// wait for the turn of the query, returning the error of the context if it is done in the meantime.
+func (rl *rateLimiter) wait(ctx context.Context, qry Query) error {
+	key := ""
+	if rlQry, implements := qry.(RateLimitable); implements {
+		key = string(rlQry.RateLimitKey())
+	}
+	delay, allowed := rl.reserve(key, time.Now())
+	if !allowed {
+		return NewErrorQueryRateLimited(qry, delay)
+	}
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		rl.refund(key)
+		return ctx.Err()
+	}
+}
+
+// reserve a token of the bucket of the key, returning the delay until it is available.
+// Whenever the query should not wait for the token, it is not reserved.
+func (rl *rateLimiter) reserve(key string, now time.Time) (time.Duration, bool) {
+	rl.Lock()
+	defer rl.Unlock()
+	bkt := rl.bucket(key, now)
+	if bkt.tokens >= 1 {
+		bkt.tokens--
+		return 0, true
+	}
+	delay := rl.delay(bkt)
+	if !rl.opts.Wait || (rl.opts.MaxWait > 0 && delay > rl.opts.MaxWait) {
+		return delay, false
+	}
+	// the token is borrowed from the future
+	bkt.tokens--
+	return delay, true
+}
+
+func (rl *rateLimiter) refund(key string) {
+	rl.Lock()
+	if bkt, exists := rl.buckets[key]; exists {
+		bkt.tokens = math.Min(bkt.tokens+1, float64(rl.opts.Burst))
+	}
+	rl.Unlock()
+}
+
+// bucket returns the bucket of the key refilled up to now.
+func (rl *rateLimiter) bucket(key string, now time.Time) *tokenBucket {
+	bkt, exists := rl.buckets[key]
+	if !exists {
+		rl.sweep(now)
+		bkt = &tokenBucket{tokens: float64(rl.opts.Burst), last: now}
+		rl.buckets[key] = bkt
+		return bkt
+	}
+	if now.After(bkt.last) {
+		bkt.tokens = math.Min(bkt.tokens+now.Sub(bkt.last).Seconds()*rl.opts.Rate, float64(rl.opts.Burst))
+		bkt.last = now
+	}
+	return bkt
+}
+
+// delay until the bucket holds a token.
+func (rl *rateLimiter) delay(bkt *tokenBucket) time.Duration {
+	if rl.opts.Rate <= 0 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration((1 - bkt.tokens) / rl.opts.Rate * float64(time.Second))
+}
+
+// sweep discards the buckets that are full by now, since they are equivalent to new ones.
+// It only runs once the number of buckets doubles, so the buckets of high-cardinality keys do not accumulate.
+func (rl *rateLimiter) sweep(now time.Time) {
+	if len(rl.buckets) < rl.sweepAt {
+		return
+	}
+	for key, bkt := range rl.buckets {
+		if bkt.tokens+now.Sub(bkt.last).Seconds()*rl.opts.Rate >= float64(rl.opts.Burst) {
+			delete(rl.buckets, key)
+		}
+	}
+	rl.sweepAt = int(math.Max(1024, float64(2*len(rl.buckets))))
+}
@@ -0,0 +1,31 @@
+package query
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Reserve(t *testing.T) {
+	rl := newRateLimiter(RateLimitOptions{Rate: 2, Burst: 2, Wait: true})
+	now := time.Now()
+	for i, exp := range []time.Duration{0, 0, time.Millisecond * 500, time.Second} {
+		if delay, allowed := rl.reserve("", now); !allowed || delay != exp {
+			t.Errorf("Unexpected delay %s for reservation %d.", delay, i)
+		}
+	}
+	// the bucket refills over time
+	if delay, _ := rl.reserve("", now.Add(time.Second*2)); delay != 0 {
+		t.Errorf("Expected the bucket to refill, got a delay of %s.", delay)
+	}
+
+	// the full buckets are discarded
+	rl = newRateLimiter(RateLimitOptions{Rate: 1})
+	for i := 0; i < 1024; i++ {
+		rl.reserve(fmt.Sprintf("KEY-%d", i), now)
+	}
+	rl.reserve("KEY", now.Add(time.Second))
+	if len(rl.buckets) != 1 {
+		t.Errorf("Expected the full buckets to be discarded, %d remain.", len(rl.buckets))
+	}
+}
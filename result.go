@@ -11,16 +11,31 @@ import (
 type Result struct {
 	sync.Mutex
 	resultCore
-	data      []interface{}
-	cacheKey  []byte
-	cachedAt  time.Time
-	expiresAt time.Time
+	data       []interface{}
+	shared     *uint32
+	stale      *uint32
+	cacheKey   []byte
+	cachedAt   time.Time
+	expiresAt  time.Time
+	staleUntil time.Time
+}
+
+// NewResult creates a new result holding the provided data.
+// It may be used by middlewares to short-circuit the execution of queries.
+func NewResult(data ...interface{}) *Result {
+	res := newResult()
+	if len(data) > 0 {
+		res.Set(data)
+	}
+	return res
 }
 
 func newResult() *Result {
 	return &Result{
 		resultCore: newResultCore(),
 		data:       make([]interface{}, 0, 1),
+		shared:     new(uint32),
+		stale:      new(uint32),
 	}
 }
 
@@ -29,6 +44,8 @@ func newCacheableResult(query Cacheable) *Result {
 		resultCore: newResultCore(),
 		cacheKey:   query.CacheKey(),
 		data:       make([]interface{}, 0, 1),
+		shared:     new(uint32),
+		stale:      new(uint32),
 	}
 }
 
@@ -53,6 +70,29 @@ func (res *Result) ExpiresAt() time.Time {
 	return expiresAt
 }
 
+// IsShared can be used to verify if this result was shared among concurrent identical queries.
+func (res *Result) IsShared() bool {
+	return atomic.LoadUint32(res.shared) == 1
+}
+
+// StaleUntil is used to identify until which point this result may be used after it expires.
+// It matches ExpiresAt unless the query implements Revalidatable.
+// Cache adapters should retain the result until this point.
+func (res *Result) StaleUntil() time.Time {
+	res.Lock()
+	staleUntil := res.staleUntil
+	if staleUntil.IsZero() {
+		staleUntil = res.expiresAt
+	}
+	res.Unlock()
+	return staleUntil
+}
+
+// IsStale can be used to verify if this result expired and is being refreshed in the background.
+func (res *Result) IsStale() bool {
+	return atomic.LoadUint32(res.stale) == 1
+}
+
 //------Provide Data------//
 
 // Set all the data of this result
@@ -85,6 +125,28 @@ func (res *Result) All() []interface{} {
 
 //------Internal------//
 
+// resultSnapshot is the state of a result, which can be restored to discard the changes of a failed handler.
+type resultSnapshot struct {
+	data            []interface{}
+	handled         uint32
+	stopPropagation uint32
+}
+
+func (res *Result) snapshot() resultSnapshot {
+	return resultSnapshot{
+		data:            res.data,
+		handled:         atomic.LoadUint32(res.handled),
+		stopPropagation: atomic.LoadUint32(res.stopPropagation),
+	}
+}
+
+// restore the data and the flags of the result (replaced or appended data is discarded).
+func (res *Result) restore(snap resultSnapshot) {
+	res.data = snap.data
+	atomic.StoreUint32(res.handled, snap.handled)
+	atomic.StoreUint32(res.stopPropagation, snap.stopPropagation)
+}
+
 func (res *Result) increaseCapacity() {
 	l := len(res.data)
 	c := int(math.Ceil(float64(cap(res.data)) * 1.1))
@@ -100,12 +162,47 @@ func (res *Result) expires(at time.Time) {
 	res.Unlock()
 }
 
+func (res *Result) stalesUntil(at time.Time) {
+	res.Lock()
+	res.staleUntil = at
+	res.Unlock()
+}
+
 func (res *Result) cached(at time.Time) {
 	res.Lock()
 	res.cachedAt = at
 	res.Unlock()
 }
 
+func (res *Result) isExpired(at time.Time) bool {
+	expiresAt := res.ExpiresAt()
+	return !expiresAt.IsZero() && at.After(expiresAt)
+}
+
+func (res *Result) markStale() {
+	atomic.CompareAndSwapUint32(res.stale, 0, 1)
+}
+
+// sharedCopy returns a copy of the result marked as shared.
+// This way the instance provided to the cache adapters is not marked, so the following cache hits are not reported as shared.
+func (res *Result) sharedCopy() *Result {
+	res.Lock()
+	defer res.Unlock()
+	cp := &Result{
+		resultCore: res.resultCore.copy(),
+		data:       res.data,
+		shared:     new(uint32),
+		stale:      new(uint32),
+		cacheKey:   res.cacheKey,
+		cachedAt:   res.cachedAt,
+		expiresAt:  res.expiresAt,
+		staleUntil: res.staleUntil,
+	}
+	atomic.StoreUint32(cp.shared, 1)
+	atomic.StoreUint32(cp.stale, atomic.LoadUint32(res.stale))
+	return cp
+}
+
 func (res *Result) isHandled() bool {
 	return len(res.data) > 0 || atomic.LoadUint32(res.handled) == 1
 }
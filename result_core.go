@@ -53,6 +53,18 @@ func (res *resultCore) isHandled() bool {
 	return atomic.LoadUint32(res.handled) == 1
 }
 
+func (res *resultCore) copy() resultCore {
+	cp := resultCore{
+		stopPropagation: new(uint32),
+		handled:         new(uint32),
+		fresh:           new(uint32),
+	}
+	atomic.StoreUint32(cp.stopPropagation, atomic.LoadUint32(res.stopPropagation))
+	atomic.StoreUint32(cp.handled, atomic.LoadUint32(res.handled))
+	atomic.StoreUint32(cp.fresh, atomic.LoadUint32(res.fresh))
+	return cp
+}
+
 func (res *resultCore) loadedFromCache() {
 	atomic.CompareAndSwapUint32(res.fresh, 1, 0)
 }
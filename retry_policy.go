@@ -0,0 +1,64 @@
+package query
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy may optionally be provided to the bus to retry the handlers of regular queries whenever they fail.
+// Each handler is retried individually, so the handlers preceding it in the propagation chain are not invoked again.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts (including the first one). Values below 2 disable the retries.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry.
+	InitialBackoff time.Duration
+	// MaxBackoff limits the delay between retries (0 means no limit).
+	MaxBackoff time.Duration
+	// Multiplier is applied to the delay after each retry. It defaults to 2 (exponential backoff).
+	Multiplier float64
+	// Jitter randomly reduces each delay by up to the provided fraction (between 0 and 1).
+	Jitter float64
+	// Retryable determines which errors are retried. All errors are retried if not provided.
+	Retryable func(err error) bool
+}
+
+func (policy *RetryPolicy) retryable(attempt int, err error) bool {
+	if attempt >= policy.MaxAttempts {
+		return false
+	}
+	return policy.Retryable == nil || policy.Retryable(err)
+}
+
+// backoff determines the delay before the next attempt.
+func (policy *RetryPolicy) backoff(attempt int) time.Duration {
+	multiplier := policy.Multiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+	delay := float64(policy.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if policy.MaxBackoff > 0 && delay > float64(policy.MaxBackoff) {
+		delay = float64(policy.MaxBackoff)
+	}
+	if policy.Jitter > 0 {
+		delay -= delay * math.Min(policy.Jitter, 1) * rand.Float64()
+	}
+	return time.Duration(delay)
+}
+
+// wait for the backoff of the attempt to elapse, returning false if the context is done in the meantime.
+func (policy *RetryPolicy) wait(ctx context.Context, attempt int) bool {
+	delay := policy.backoff(attempt)
+	if delay <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,21 @@
+package query
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := &RetryPolicy{InitialBackoff: time.Millisecond * 10, MaxBackoff: time.Millisecond * 50}
+	for attempt, exp := range []time.Duration{time.Millisecond * 10, time.Millisecond * 20, time.Millisecond * 40, time.Millisecond * 50} {
+		if delay := policy.backoff(attempt + 1); delay != exp {
+			t.Errorf("Expected a backoff of %s, got %s.", exp, delay)
+		}
+	}
+	policy = &RetryPolicy{InitialBackoff: time.Millisecond * 10, Multiplier: 3, Jitter: 0.5}
+	for i := 0; i < 100; i++ {
+		if delay := policy.backoff(2); delay > time.Millisecond*30 || delay < time.Millisecond*15 {
+			t.Errorf("Unexpected backoff %s.", delay)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package query
+
+import "reflect"
+
+// Selective may optionally be implemented by handlers and iterator handlers to declare which query types they accept.
+// The bus will only provide them with queries of the declared types.
+// Handlers that do not implement it (or declare no types) are provided with all queries.
+type Selective interface {
+	Handles() []Query
+}
+
+// route is a handler along with its position in the handlers provided to the bus.
+type route[H any] struct {
+	index int
+	hdl   H
+}
+
+type router[H any] struct {
+	catchAll []route[H]
+	routes   map[reflect.Type][]route[H]
+}
+
+func newRouter[H any](hdls []H) *router[H] {
+	rtr := &router[H]{
+		catchAll: make([]route[H], 0),
+		routes:   make(map[reflect.Type][]route[H]),
+	}
+	accepts := make([]map[reflect.Type]bool, len(hdls))
+	for i, hdl := range hdls {
+		accepts[i] = acceptedTypes(hdl)
+		if accepts[i] == nil {
+			rtr.catchAll = append(rtr.catchAll, route[H]{index: i, hdl: hdl})
+			continue
+		}
+		for typ := range accepts[i] {
+			rtr.routes[typ] = nil
+		}
+	}
+	// every route holds the handlers that accept its type and the catch-all handlers, respecting the handler order
+	for typ := range rtr.routes {
+		for i, hdl := range hdls {
+			if accepts[i] == nil || accepts[i][typ] {
+				rtr.routes[typ] = append(rtr.routes[typ], route[H]{index: i, hdl: hdl})
+			}
+		}
+	}
+	return rtr
+}
+
+func (rtr *router[H]) route(qry Query) []route[H] {
+	if len(rtr.routes) > 0 {
+		if rts, routed := rtr.routes[reflect.TypeOf(qry)]; routed {
+			return rts
+		}
+	}
+	return rtr.catchAll
+}
+
+func acceptedTypes(hdl interface{}) map[reflect.Type]bool {
+	slt, implements := hdl.(Selective)
+	if !implements {
+		return nil
+	}
+	qrys := slt.Handles()
+	if len(qrys) == 0 {
+		return nil
+	}
+	types := make(map[reflect.Type]bool, len(qrys))
+	for _, qry := range qrys {
+		typ := reflect.TypeOf(qry)
+		if typ == nil {
+			return nil
+		}
+		types[typ] = true
+	}
+	return types
+}
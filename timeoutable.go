@@ -0,0 +1,15 @@
+package query
+
+import "time"
+
+// Timeoutable may optionally be implemented by queries to override the timeout of the bus (see Bus.QueryTimeout).
+// A timeout of 0 disables it for the query.
+type Timeoutable interface {
+	Timeout() time.Duration
+}
+
+// ListenerTimeoutable may optionally be implemented by iterator queries to override the listener timeout of the bus (see Bus.IteratorListenerTimeout).
+// A timeout of 0 disables it for the query.
+type ListenerTimeoutable interface {
+	ListenerTimeout() time.Duration
+}
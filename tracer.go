@@ -0,0 +1,182 @@
+package query
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// SpanKind identifies the step of the querying process represented by a span.
+type SpanKind uint8
+
+const (
+	// SpanQuery represents the execution of a regular query (Bus.Query).
+	SpanQuery SpanKind = iota
+	// SpanHandler represents the invocation of a handler (or iterator handler) in the propagation chain.
+	SpanHandler
+	// SpanCacheGet represents the retrieval of a result from a cache adapter.
+	SpanCacheGet
+	// SpanCacheSet represents the storage of a result in a cache adapter.
+	SpanCacheSet
+	// SpanIteratorQueueWait represents the time an iterator query waits in the iterator query queue.
+	SpanIteratorQueueWait
+	// SpanIteratorQuery represents the handling of an iterator query by an iterator worker.
+	SpanIteratorQuery
+)
+
+// String returns the name of the SpanKind.
+func (kind SpanKind) String() string {
+	switch kind {
+	case SpanQuery:
+		return "query"
+	case SpanHandler:
+		return "query.handler"
+	case SpanCacheGet:
+		return "query.cache.get"
+	case SpanCacheSet:
+		return "query.cache.set"
+	case SpanIteratorQueueWait:
+		return "query.iterator.queue_wait"
+	case SpanIteratorQuery:
+		return "query.iterator"
+	}
+	return "query.unknown"
+}
+
+// Attribute keys set by the bus on the spans.
+const (
+	// AttributeCacheHit is set on SpanQuery and SpanCacheGet spans of Cacheable queries.
+	AttributeCacheHit = "query.cache.hit"
+	// AttributeCacheStored is set on SpanCacheSet spans.
+	AttributeCacheStored = "query.cache.stored"
+	// AttributePropagationStopped is set on SpanHandler spans.
+	AttributePropagationStopped = "query.propagation_stopped"
+)
+
+// SpanInfo describes the step of the querying process represented by a span.
+type SpanInfo struct {
+	Kind  SpanKind
+	Query Query
+	// HandlerIndex is the position of the handler in the handlers provided to the bus (-1 if not applicable).
+	HandlerIndex int
+	// Handler is the Handler or IteratorHandler invoked (nil if not applicable).
+	Handler interface{}
+	// CacheAdapter is the CacheAdapter used (nil if not applicable).
+	CacheAdapter CacheAdapter
+}
+
+// Tracer may optionally be provided to the bus to trace the querying process (e.g. bridging to OpenTelemetry).
+// Start is called at the beginning of every step, and the returned context is used for the following nested steps.
+type Tracer interface {
+	Start(ctx context.Context, info SpanInfo) (context.Context, Span)
+}
+
+// Span represents a step of the querying process being traced.
+type Span interface {
+	SetAttribute(key string, value interface{})
+	End(err error)
+}
+
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, _ SpanInfo) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(string, interface{}) {}
+func (noopSpan) End(error)                        {}
+
+//------Recorder------//
+
+// RecordedSpan is a span recorded by the SpanRecorder.
+type RecordedSpan struct {
+	SpanInfo
+	ID         int
+	ParentID   int
+	Attributes map[string]interface{}
+	StartedAt  time.Time
+	EndedAt    time.Time
+	Err        error
+}
+
+// SpanRecorder is a Tracer that records the spans in memory. It is mostly intended for testing purposes.
+type SpanRecorder struct {
+	sync.Mutex
+	spans []*RecordedSpan
+}
+
+// NewSpanRecorder creates a new *SpanRecorder.
+func NewSpanRecorder() *SpanRecorder {
+	return &SpanRecorder{
+		spans: make([]*RecordedSpan, 0),
+	}
+}
+
+// Start records the beginning of a span. The span of the provided context (if any) is used as parent.
+func (rec *SpanRecorder) Start(ctx context.Context, info SpanInfo) (context.Context, Span) {
+	span := &recorderSpan{
+		rec: rec,
+		RecordedSpan: &RecordedSpan{
+			SpanInfo:   info,
+			Attributes: make(map[string]interface{}),
+			StartedAt:  time.Now(),
+		},
+	}
+	if parent, hasParent := ctx.Value(recorderSpanKey{}).(*recorderSpan); hasParent && parent.rec == rec {
+		span.ParentID = parent.ID
+	}
+	rec.Lock()
+	rec.spans = append(rec.spans, span.RecordedSpan)
+	span.ID = len(rec.spans)
+	rec.Unlock()
+	return context.WithValue(ctx, recorderSpanKey{}, span), span
+}
+
+// Spans returns a copy of the spans that already ended, in the order they started.
+// The ID of each span is its position (starting at 1), a ParentID of 0 means the span has no parent.
+func (rec *SpanRecorder) Spans() []RecordedSpan {
+	rec.Lock()
+	defer rec.Unlock()
+	spans := make([]RecordedSpan, 0, len(rec.spans))
+	for _, span := range rec.spans {
+		if span.EndedAt.IsZero() {
+			continue
+		}
+		cp := *span
+		cp.Attributes = make(map[string]interface{}, len(span.Attributes))
+		for key, val := range span.Attributes {
+			cp.Attributes[key] = val
+		}
+		spans = append(spans, cp)
+	}
+	return spans
+}
+
+// Reset discards all the recorded spans.
+func (rec *SpanRecorder) Reset() {
+	rec.Lock()
+	rec.spans = make([]*RecordedSpan, 0)
+	rec.Unlock()
+}
+
+type recorderSpanKey struct{}
+
+type recorderSpan struct {
+	*RecordedSpan
+	rec *SpanRecorder
+}
+
+func (span *recorderSpan) SetAttribute(key string, value interface{}) {
+	span.rec.Lock()
+	span.Attributes[key] = value
+	span.rec.Unlock()
+}
+
+func (span *recorderSpan) End(err error) {
+	span.rec.Lock()
+	span.EndedAt = time.Now()
+	span.Err = err
+	span.rec.Unlock()
+}
@@ -0,0 +1,89 @@
+package query
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSpanRecorder(t *testing.T) {
+	bus := NewBus()
+	rec := NewSpanRecorder()
+	bus.Tracer(rec)
+	bus.Handlers(&testHandler{}, &testHandlerWithErrors{}, &testCountingHandler{handled: new(uint32)})
+	bus.IteratorWorkerPoolSize(1)
+	bus.InitializeIteratorHandlers(&testIteratorHandler{})
+	defer bus.Shutdown()
+
+	qry := &testCountingCacheQuery{key: "TRACE"}
+	_, _ = bus.Query(qry)
+	spans := rec.Spans()
+	expected := []struct {
+		kind     SpanKind
+		parentID int
+		index    int
+	}{
+		{SpanQuery, 0, -1},
+		{SpanCacheGet, 1, -1},
+		{SpanHandler, 1, 0},
+		{SpanHandler, 1, 1},
+		{SpanHandler, 1, 2},
+		{SpanCacheSet, 1, -1},
+	}
+	if len(spans) != len(expected) {
+		t.Fatalf("Expected %d spans, got %d.", len(expected), len(spans))
+	}
+	for i, exp := range expected {
+		span := spans[i]
+		if span.Kind != exp.kind || span.ParentID != exp.parentID || span.HandlerIndex != exp.index || span.Query != qry {
+			t.Errorf("Unexpected span %d: %s (parent %d, handler %d).", i, span.Kind, span.ParentID, span.HandlerIndex)
+		}
+		if span.EndedAt.Before(span.StartedAt) {
+			t.Errorf("Expected span %d to end after it started.", i)
+		}
+	}
+	if spans[0].Attributes[AttributeCacheHit] != false || spans[1].Attributes[AttributeCacheHit] != false {
+		t.Error("Expected the query to miss the cache.")
+	}
+	if _, isCounting := spans[4].Handler.(*testCountingHandler); !isCounting {
+		t.Error("Expected the span to carry the handler.")
+	}
+	if spans[5].Attributes[AttributeCacheStored] != true || spans[5].CacheAdapter == nil {
+		t.Error("Expected the result to be stored in the cache adapter.")
+	}
+
+	rec.Reset()
+	_, _ = bus.Query(qry)
+	spans = rec.Spans()
+	if len(spans) != 2 || spans[0].Attributes[AttributeCacheHit] != true || spans[1].Attributes[AttributeCacheHit] != true {
+		t.Error("Expected the query to hit the cache without invoking the handlers.")
+	}
+
+	rec.Reset()
+	_, err := bus.Query(&testQueryError{})
+	spans = rec.Spans()
+	if len(spans) != 3 || spans[0].Err != err || spans[2].Err != errors.Unwrap(err) || spans[1].Err != nil {
+		t.Error("Expected the error to be recorded on the query and handler spans.")
+	}
+
+	rec.Reset()
+	res, _ := bus.IteratorQuery(&testQueryStruct{})
+	for range res.Iterate() {
+	}
+	spans = rec.Spans()
+	if len(spans) != 3 {
+		t.Fatalf("Expected 3 iterator spans, got %d.", len(spans))
+	}
+	if spans[0].Kind != SpanIteratorQueueWait || spans[1].Kind != SpanIteratorQuery || spans[2].Kind != SpanHandler {
+		t.Error("Unexpected iterator spans.")
+	}
+	if spans[2].ParentID != spans[1].ID || spans[2].Attributes[AttributePropagationStopped] != true {
+		t.Error("Expected the iterator handler span to be nested in the iterator query span.")
+	}
+
+	rec.Reset()
+	bus.Tracer(nil)
+	_, _ = bus.Query(&testQueryStruct{})
+	if len(rec.Spans()) != 0 {
+		t.Error("Expected no spans once the tracer is removed.")
+	}
+}
@@ -0,0 +1,87 @@
+package query
+
+import (
+	"context"
+	"reflect"
+)
+
+// HandlerFunc is a type-safe query handler for the queries of type Q.
+// The value returned is added to the result, which is then marked as done.
+// Queries of any other type are ignored, so they propagate to the following handlers.
+type HandlerFunc[Q Query, R any] func(ctx context.Context, qry Q) (R, error)
+
+// Handle allows a HandlerFunc to be used as a Handler.
+func (fn HandlerFunc[Q, R]) Handle(qry Query, res *Result) error {
+	return fn.HandleContext(context.Background(), qry, res)
+}
+
+// HandleContext allows a HandlerFunc to be used as a ContextHandler.
+func (fn HandlerFunc[Q, R]) HandleContext(ctx context.Context, qry Query, res *Result) error {
+	q, matches := qry.(Q)
+	if !matches {
+		return nil
+	}
+	val, err := fn(ctx, q)
+	if err != nil {
+		return err
+	}
+	res.Add(val)
+	res.Done()
+	return nil
+}
+
+// Handles allows a HandlerFunc to be routed only the queries of type Q.
+func (fn HandlerFunc[Q, R]) Handles() []Query {
+	var qry Q
+	return []Query{qry}
+}
+
+// Register appends a type-safe query handler to the handlers of the bus.
+func Register[Q Query, R any](bus *Bus, hdl HandlerFunc[Q, R]) {
+	hdls := make([]Handler, len(bus.handlers), len(bus.handlers)+1)
+	copy(hdls, bus.handlers)
+	bus.Handlers(append(hdls, hdl)...)
+}
+
+// Ask queries the bus and returns the first value of the result as R.
+// The zero value of R is returned if the result holds no data.
+func Ask[R any](bus *Bus, qry Query) (R, error) {
+	return AskContext[R](context.Background(), bus, qry)
+}
+
+// AskContext queries the bus with a context and returns the first value of the result as R.
+// The zero value of R is returned if the result holds no data.
+func AskContext[R any](ctx context.Context, bus *Bus, qry Query) (R, error) {
+	var val R
+	res, err := bus.QueryContext(ctx, qry)
+	if err != nil || res.First() == nil {
+		return val, err
+	}
+	val, matches := res.First().(R)
+	if !matches {
+		return val, NewErrorUnexpectedResultType(qry, res.First(), reflect.TypeOf((*R)(nil)).Elem().String())
+	}
+	return val, nil
+}
+
+// AskAll queries the bus and returns all the values of the result as []R.
+func AskAll[R any](bus *Bus, qry Query) ([]R, error) {
+	return AskAllContext[R](context.Background(), bus, qry)
+}
+
+// AskAllContext queries the bus with a context and returns all the values of the result as []R.
+func AskAllContext[R any](ctx context.Context, bus *Bus, qry Query) ([]R, error) {
+	res, err := bus.QueryContext(ctx, qry)
+	if err != nil {
+		return nil, err
+	}
+	vals := make([]R, 0, len(res.All()))
+	for _, data := range res.All() {
+		val, matches := data.(R)
+		if !matches {
+			return nil, NewErrorUnexpectedResultType(qry, data, reflect.TypeOf((*R)(nil)).Elem().String())
+		}
+		vals = append(vals, val)
+	}
+	return vals, nil
+}
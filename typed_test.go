@@ -0,0 +1,86 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestRegister(t *testing.T) {
+	bus := NewBus()
+	bus.Handlers(&testHandler{})
+	Register(bus, HandlerFunc[*testTypedQuery, string](func(ctx context.Context, qry *testTypedQuery) (string, error) {
+		return fmt.Sprintf("bar-%d", qry.id), nil
+	}))
+	if len(bus.handlers) != 2 {
+		t.Error("Unexpected number of handlers.")
+	}
+
+	res, err := bus.Query(&testTypedQuery{id: 1})
+	if err != nil {
+		t.Error(err.Error())
+	}
+	if res.First() != "bar-1" {
+		t.Error("Query returned an unexpected value.")
+	}
+	// other query types must still reach the remaining handlers
+	res, err = bus.Query(&testQueryStruct{})
+	if err != nil {
+		t.Error(err.Error())
+	}
+	if res.First() != "bar" {
+		t.Error("Query returned an unexpected value.")
+	}
+}
+
+func TestAsk(t *testing.T) {
+	bus := NewBus()
+	bus.Handlers(&testHandler{})
+	Register(bus, HandlerFunc[*testTypedQuery, string](func(ctx context.Context, qry *testTypedQuery) (string, error) {
+		if qry.id < 0 {
+			return "", errors.New("query failed")
+		}
+		return fmt.Sprintf("bar-%d", qry.id), nil
+	}))
+
+	val, err := Ask[string](bus, &testTypedQuery{id: 2})
+	if err != nil {
+		t.Error(err.Error())
+	}
+	if val != "bar-2" {
+		t.Error("Query returned an unexpected value.")
+	}
+
+	vals, err := AskAll[string](bus, &testQueryStruct{})
+	if err != nil {
+		t.Error(err.Error())
+	}
+	if len(vals) != 1 || vals[0] != "bar" {
+		t.Error("Query returned an unexpected value.")
+	}
+
+	val, err = Ask[string](bus, &testQueryEmptyResult{})
+	if err != nil {
+		t.Error(err.Error())
+	}
+	if val != "" {
+		t.Error("Query returned an unexpected value.")
+	}
+
+	if _, err = Ask[string](bus, &testTypedQuery{id: -1}); err == nil {
+		t.Error("Query was expected to throw an error.")
+	}
+
+	_, err = Ask[int](bus, &testTypedQuery{id: 3})
+	ok := false
+	if err, ok = err.(ErrorUnexpectedResultType); ok && err.Error() != fmt.Sprintf("query: the result of the query %T holds a value of type string while int was expected", &testTypedQuery{}) {
+		t.Error("Unexpected ErrorUnexpectedResultType message.")
+	}
+	if !ok {
+		t.Error("Expected ErrorUnexpectedResultType error.")
+	}
+	if _, err = AskAll[int](bus, &testQueryStruct{}); err == nil {
+		t.Error("Expected ErrorUnexpectedResultType error.")
+	}
+}
@@ -1,7 +1,9 @@
 package query
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -73,6 +75,101 @@ func (*testCacheQuery2) CacheDuration() time.Duration {
 	return 0
 }
 
+type testTypedQuery struct {
+	id int
+}
+
+func (*testTypedQuery) ID() []byte {
+	return []byte("UUID-TYPED")
+}
+
+type testCountingCacheQuery struct {
+	key string
+}
+
+func (*testCountingCacheQuery) ID() []byte {
+	return []byte("UUID-COUNTING-CACHE")
+}
+
+func (qry *testCountingCacheQuery) CacheKey() []byte {
+	return []byte(qry.key)
+}
+
+func (*testCountingCacheQuery) CacheDuration() time.Duration {
+	return time.Minute
+}
+
+type testStaleCacheQuery struct {
+	testCountingCacheQuery
+}
+
+func (*testStaleCacheQuery) CacheDuration() time.Duration {
+	return time.Millisecond * 50
+}
+
+func (*testStaleCacheQuery) StaleDuration() time.Duration {
+	return time.Millisecond * 300
+}
+
+type testSlowQuery struct {
+	timeout time.Duration
+}
+
+func (*testSlowQuery) ID() []byte {
+	return []byte("UUID-SLOW")
+}
+
+type testTimeoutQuery struct {
+	testSlowQuery
+}
+
+func (qry *testTimeoutQuery) Timeout() time.Duration {
+	return qry.timeout
+}
+
+type testListenerTimeoutQuery struct {
+	testQueryStruct
+	timeout time.Duration
+}
+
+func (qry *testListenerTimeoutQuery) ListenerTimeout() time.Duration {
+	return qry.timeout
+}
+
+type testPanicQuery struct {
+}
+
+func (*testPanicQuery) ID() []byte {
+	return []byte("UUID-PANIC")
+}
+
+type testFlakyQuery struct {
+}
+
+func (*testFlakyQuery) ID() []byte {
+	return []byte("UUID-FLAKY")
+}
+
+type testRateLimitQuery struct {
+	key string
+}
+
+func (*testRateLimitQuery) ID() []byte {
+	return []byte("UUID-RATE-LIMIT")
+}
+
+func (qry *testRateLimitQuery) RateLimitKey() []byte {
+	return []byte(qry.key)
+}
+
+type testBatchQuery struct {
+	id int
+}
+
+func (*testBatchQuery) ID() []byte {
+	return []byte("UUID-BATCH")
+}
+
 type testHandlerOrderQuery struct {
 	position  *uint32
 	unordered *uint32
@@ -99,7 +196,7 @@ type testHandler struct {
 
 func (hdl *testHandler) Handle(qry Query, res *Result) error {
 	switch qry.(type) {
-	case *testQueryStruct, testQueryString:
+	case *testQueryStruct, testQueryString, *testRateLimitQuery:
 		res.Set([]interface{}{"bar"})
 		return nil
 	case *testQueryEmptyResult:
@@ -133,12 +230,36 @@ func (hdl *testHandlerOrder) Handle(qry Query, res *Result) error {
 	return nil
 }
 
+type testSelectiveHandlerOrder struct {
+	testHandlerOrder
+}
+
+func (hdl *testSelectiveHandlerOrder) Handles() []Query {
+	return []Query{&testHandlerOrderQuery{}}
+}
+
+type testSelectiveHandler struct {
+}
+
+func (hdl *testSelectiveHandler) Handle(qry Query, res *Result) error {
+	switch qry.(type) {
+	case *testQueryStruct, testQueryString:
+		res.Add("foo")
+		return nil
+	}
+	return errors.New("the selective handler received an undeclared query type")
+}
+
+func (hdl *testSelectiveHandler) Handles() []Query {
+	return []Query{&testQueryStruct{}, testQueryString("")}
+}
+
 type testIteratorHandler struct {
 }
 
 func (hdl *testIteratorHandler) Handle(qry Query, res *IteratorResult) error {
 	switch qry.(type) {
-	case *testQueryStruct, testQueryString:
+	case *testQueryStruct, *testListenerTimeoutQuery, testQueryString:
 		res.Yield("bar")
 		res.Done()
 		return nil
@@ -146,6 +267,37 @@ func (hdl *testIteratorHandler) Handle(qry Query, res *IteratorResult) error {
 	return nil
 }
 
+type testSelectiveIteratorHandler struct {
+}
+
+func (hdl *testSelectiveIteratorHandler) Handle(qry Query, res *IteratorResult) error {
+	switch qry.(type) {
+	case *testQueryStruct:
+		res.Yield("foo")
+		return nil
+	}
+	return errors.New("the selective iterator handler received an undeclared query type")
+}
+
+func (hdl *testSelectiveIteratorHandler) Handles() []Query {
+	return []Query{&testQueryStruct{}}
+}
+
+type testInfiniteIteratorHandler struct {
+	stopped chan bool
+}
+
+func (hdl *testInfiniteIteratorHandler) Handle(qry Query, res *IteratorResult) error {
+	switch qry.(type) {
+	case *testQueryUnsupported:
+		for i := 0; res.Yield(i); i++ {
+		}
+		hdl.stopped <- res.IsClosed()
+		return nil
+	}
+	return nil
+}
+
 type testIteratorHandlerWithErrors struct {
 }
 
@@ -173,6 +325,140 @@ func (hdl *testCacheHandler) Handle(qry Query, res *Result) error {
 	return nil
 }
 
+type testCountingHandler struct {
+	handled *uint32
+	delay   time.Duration
+}
+
+func (hdl *testCountingHandler) Handle(qry Query, res *Result) error {
+	switch qry.(type) {
+	case *testCountingCacheQuery, *testStaleCacheQuery:
+		atomic.AddUint32(hdl.handled, 1)
+		time.Sleep(hdl.delay)
+		res.Add("bar")
+		return nil
+	}
+	return nil
+}
+
+func (hdl *testCountingHandler) Handled() uint32 {
+	return atomic.LoadUint32(hdl.handled)
+}
+
+type testSlowHandler struct {
+}
+
+func (hdl *testSlowHandler) Handle(qry Query, res *Result) error {
+	switch qry.(type) {
+	case *testSlowQuery, *testTimeoutQuery:
+		time.Sleep(time.Millisecond * 200)
+		res.Add("bar")
+		return nil
+	}
+	return nil
+}
+
+type testPanicHandler struct {
+}
+
+func (hdl *testPanicHandler) Handle(qry Query, res *Result) error {
+	switch qry.(type) {
+	case *testPanicQuery:
+		panic("handler panicked")
+	}
+	return nil
+}
+
+type testFlakyHandler struct {
+	failures uint32
+	attempts *uint32
+	done     bool
+}
+
+func (hdl *testFlakyHandler) Handle(qry Query, res *Result) error {
+	switch qry.(type) {
+	case *testFlakyQuery:
+		attempt := atomic.AddUint32(hdl.attempts, 1)
+		if attempt <= hdl.failures {
+			if hdl.done {
+				res.Set([]interface{}{attempt})
+				res.Done()
+			} else {
+				res.Add(attempt)
+			}
+			return errors.New("handler failed")
+		}
+		res.Add(attempt)
+		return nil
+	}
+	return nil
+}
+
+func (hdl *testFlakyHandler) Attempts() uint32 {
+	return atomic.LoadUint32(hdl.attempts)
+}
+
+type testFallbackHandler struct {
+}
+
+func (hdl *testFallbackHandler) Handle(qry Query, res *Result) error {
+	switch qry.(type) {
+	case *testFlakyQuery:
+		res.Add("fallback")
+		return nil
+	}
+	return nil
+}
+
+type testBatchHandler struct {
+	sync.Mutex
+	batches [][]int
+}
+
+func (hdl *testBatchHandler) HandleBatch(qrys []Query, ress []*Result) error {
+	ids := make([]int, len(qrys))
+	for i, qry := range qrys {
+		ids[i] = qry.(*testBatchQuery).id
+	}
+	hdl.Lock()
+	hdl.batches = append(hdl.batches, ids)
+	hdl.Unlock()
+	for i, id := range ids {
+		switch {
+		case id < 0:
+			return errors.New("batch failed")
+		case id == 0:
+			panic("batch handler panicked")
+		}
+		ress[i].Add(fmt.Sprintf("item-%d", id))
+	}
+	return nil
+}
+
+func (hdl *testBatchHandler) Handles() []Query {
+	return []Query{&testBatchQuery{}}
+}
+
+func (hdl *testBatchHandler) Batches() [][]int {
+	hdl.Lock()
+	defer hdl.Unlock()
+	batches := hdl.batches
+	hdl.batches = nil
+	return batches
+}
+
+type testPanicIteratorHandler struct {
+}
+
+func (hdl *testPanicIteratorHandler) Handle(qry Query, res *IteratorResult) error {
+	switch qry.(type) {
+	case *testPanicQuery:
+		res.Yield("bar")
+		panic(errors.New("iterator handler panicked"))
+	}
+	return nil
+}
+
 type testIteratorHandlerOrder struct {
 	position uint32
 }
@@ -186,6 +472,52 @@ func (hdl *testIteratorHandlerOrder) Handle(qry Query, res *IteratorResult) erro
 	return nil
 }
 
+type testContextHandler struct {
+}
+
+func (hdl *testContextHandler) Handle(qry Query, res *Result) error {
+	return errors.New("the context handler must be handled with HandleContext")
+}
+
+func (hdl *testContextHandler) HandleContext(ctx context.Context, qry Query, res *Result) error {
+	switch qry.(type) {
+	case *testQueryStruct:
+		res.Add(ctx.Value(testContextKey{}))
+		return nil
+	case *testQueryError:
+		if cancel, isCancel := ctx.Value(testContextKey{}).(context.CancelFunc); isCancel {
+			cancel()
+		}
+		res.Add("bar")
+		return nil
+	}
+	return nil
+}
+
+type testContextIteratorHandler struct {
+}
+
+func (hdl *testContextIteratorHandler) Handle(qry Query, res *IteratorResult) error {
+	return errors.New("the context iterator handler must be handled with HandleContext")
+}
+
+func (hdl *testContextIteratorHandler) HandleContext(ctx context.Context, qry Query, res *IteratorResult) error {
+	switch qry.(type) {
+	case *testQueryStruct:
+		res.Yield(ctx.Value(testContextKey{}))
+		return nil
+	case *testQueryError:
+		if cancel, isCancel := ctx.Value(testContextKey{}).(context.CancelFunc); isCancel {
+			cancel()
+		}
+		res.Yield("bar")
+		return nil
+	}
+	return nil
+}
+
+type testContextKey struct{}
+
 //------Error Handlers------//
 
 type storeErrorsHandler struct {
@@ -215,3 +547,46 @@ func (hdl *storeErrorsHandler) key(qry Query) string {
 	}
 	return string(qry.ID())
 }
+
+type storeCircuitStatesHandler struct {
+	sync.Mutex
+	changes []ErrorCircuitStateChanged
+}
+
+func (hdl *storeCircuitStatesHandler) Handle(qry Query, err error) {
+	if err, isStateChange := err.(ErrorCircuitStateChanged); isStateChange {
+		hdl.Lock()
+		hdl.changes = append(hdl.changes, err)
+		hdl.Unlock()
+	}
+}
+
+func (hdl *storeCircuitStatesHandler) Last() ErrorCircuitStateChanged {
+	hdl.Lock()
+	defer hdl.Unlock()
+	if len(hdl.changes) == 0 {
+		return ErrorCircuitStateChanged{}
+	}
+	return hdl.changes[len(hdl.changes)-1]
+}
+
+//------Event Listeners------//
+
+type storeEventsListener struct {
+	sync.Mutex
+	events []Event
+}
+
+func (lst *storeEventsListener) Handle(evt Event) {
+	lst.Lock()
+	lst.events = append(lst.events, evt)
+	lst.Unlock()
+}
+
+func (lst *storeEventsListener) Events() []Event {
+	lst.Lock()
+	defer lst.Unlock()
+	events := lst.events
+	lst.events = nil
+	return events
+}